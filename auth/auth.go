@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Options /metrics 和 /admin 等管理用路由的认证，都未设定时不认证。
+// 同时设定了Basic认证和Bearer令牌时，任意一种通过即可。
+// 密码和令牌可以从文件（如k8s Secret挂载的文件）读取，避免写入配置文件
+type Options struct {
+	Username        string `mapstructure:"username"`        // Basic认证的用户名
+	Password        string `mapstructure:"password"`        // Basic认证的密码
+	PasswordFile    string `mapstructure:"passwordfile"`    // 保存Basic认证密码的文件，优先于password
+	BearerToken     string `mapstructure:"bearertoken"`     // Bearer令牌，和Prometheus的 authorization.credentials 一致
+	BearerTokenFile string `mapstructure:"bearertokenfile"` // 保存Bearer令牌的文件，优先于bearertoken
+}
+
+// Load 从文件读取密码和令牌（去掉末尾的换行），并检查设定
+func (o Options) Load() (Options, error) {
+	var err error
+	if o.PasswordFile != "" {
+		if o.Password, err = ReadSecret(o.PasswordFile); err != nil {
+			return o, err
+		}
+	}
+	if o.BearerTokenFile != "" {
+		if o.BearerToken, err = ReadSecret(o.BearerTokenFile); err != nil {
+			return o, err
+		}
+	}
+	return o, o.Validate()
+}
+
+// Enabled 是否需要认证
+func (o Options) Enabled() bool {
+	return o.Username != "" || o.BearerToken != "" || o.BearerTokenFile != ""
+}
+
+// Validate 用户名和密码需同时设定
+func (o Options) Validate() error {
+	if (o.Username == "") != (o.Password == "" && o.PasswordFile == "") {
+		return fmt.Errorf("username and password must be set together")
+	}
+	return nil
+}
+
+// Authorize 判断请求的认证信息是否正确，不需要认证时总是通过
+func (o Options) Authorize(r *http.Request) bool {
+	if !o.Enabled() {
+		return true
+	}
+	if o.Username != "" {
+		if user, pass, ok := r.BasicAuth(); ok && secureEqual(user, o.Username) && secureEqual(pass, o.Password) {
+			return true
+		}
+	}
+	if o.BearerToken != "" {
+		auth := r.Header.Get("Authorization")
+		if len(auth) > len("Bearer ") && strings.EqualFold(auth[:len("Bearer ")], "Bearer ") &&
+			secureEqual(auth[len("Bearer "):], o.BearerToken) {
+			return true
+		}
+	}
+	return false
+}
+
+// Challenge 认证失败时的 WWW-Authenticate 应答头
+func (o Options) Challenge() string {
+	if o.Username != "" {
+		return `Basic realm="httpserver", charset="UTF-8"`
+	}
+	return `Bearer realm="httpserver"`
+}
+
+// ReadSecret 读取文件中的密码或令牌（去掉末尾的换行），如挂载的Kubernetes Secret
+func ReadSecret(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read secret: %w", err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// secureEqual 以固定时间比较，先取哈希以免泄露长度
+func secureEqual(a, b string) bool {
+	ha, hb := sha256.Sum256([]byte(a)), sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnit_options(t *testing.T) {
+	assert := assert.New(t)
+
+	request := func(setup func(r *http.Request)) *http.Request {
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		if setup != nil {
+			setup(r)
+		}
+		return r
+	}
+
+	none := Options{}
+	assert.False(none.Enabled())
+	assert.True(none.Authorize(request(nil)))
+
+	basic := Options{Username: "prometheus", Password: "secret"}
+	assert.True(basic.Authorize(request(func(r *http.Request) { r.SetBasicAuth("prometheus", "secret") })))
+	assert.False(basic.Authorize(request(func(r *http.Request) { r.SetBasicAuth("prometheus", "wrong") })))
+	assert.False(basic.Authorize(request(nil)))
+	assert.Contains(basic.Challenge(), "Basic")
+
+	bearer := Options{BearerToken: "token"}
+	assert.True(bearer.Authorize(request(func(r *http.Request) { r.Header.Set("Authorization", "Bearer token") })))
+	assert.True(bearer.Authorize(request(func(r *http.Request) { r.Header.Set("Authorization", "bearer token") })))
+	assert.False(bearer.Authorize(request(func(r *http.Request) { r.Header.Set("Authorization", "Bearer other") })))
+	assert.False(bearer.Authorize(request(func(r *http.Request) { r.SetBasicAuth("prometheus", "token") })))
+	assert.Contains(bearer.Challenge(), "Bearer")
+
+	assert.Error(Options{Username: "prometheus"}.Validate())
+	assert.NoError(basic.Validate())
+}
+
+func TestUnit_optionsLoad(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	assert.NoError(os.WriteFile(filepath.Join(dir, "password"), []byte("from-file\n"), 0o600))
+	assert.NoError(os.WriteFile(filepath.Join(dir, "token"), []byte("token-file"), 0o600))
+
+	o, err := Options{
+		Username:        "prometheus",
+		Password:        "ignored",
+		PasswordFile:    filepath.Join(dir, "password"),
+		BearerTokenFile: filepath.Join(dir, "token"),
+	}.Load()
+	assert.NoError(err)
+	assert.Equal("from-file", o.Password)
+	assert.Equal("token-file", o.BearerToken)
+	assert.True(o.Authorize(func() *http.Request {
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		r.SetBasicAuth("prometheus", "from-file")
+		return r
+	}()))
+
+	// 文件不存在时为错误，以免在没有认证的状态下启动
+	_, err = Options{BearerTokenFile: filepath.Join(dir, "missing")}.Load()
+	assert.Error(err)
+	_, err = Options{Username: "prometheus"}.Load()
+	assert.Error(err)
+}
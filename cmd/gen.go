@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/metrics"
+	"github.com/kabacloud/cloudnativehomework4-module10/service"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// 规则文件的格式
+const (
+	rulesFormatRules          = "rules"          // Prometheus的 rule_files
+	rulesFormatPrometheusRule = "prometheusrule" // Prometheus Operator 的 PrometheusRule 资源
+)
+
+var (
+	genOutput string // 输出的文件，为空或-时输出到标准输出
+
+	rulesFormat    string
+	rulesName      string
+	rulesNamespace string
+	rulesLabels    map[string]string
+	rulesOptions   metrics.RulesOptions
+
+	dashboardOptions metrics.DashboardOptions
+)
+
+// genCmd 按代码中注册的指标生成监控用的配置
+var genCmd = &cobra.Command{
+	Use:   "gen",
+	Short: "生成监控用的配置",
+	Long:  `按服务实际注册的指标（和 serve 使用相同的配置文件）生成Prometheus规则等监控用的配置，避免与指标名不一致。`,
+}
+
+// genRulesCmd 生成Prometheus的录制规则和告警规则
+var genRulesCmd = &cobra.Command{
+	Use:   "rules",
+	Short: "生成Prometheus的录制规则和告警规则",
+	Long: `生成以下规则，没有注册的指标不生成相应的规则：
+	- 录制规则 : 各路由延时的p50/p90/p99、请求速率和5xx比例
+	- 告警规则 : 延时过高、5xx比例过高、Pod未就绪、SLO错误预算燃烧过快
+
+例：
+	homework gen rules --config config.yaml --format prometheusrule --namespace monitoring -o rules.yaml`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return execGenRules()
+	},
+}
+
+// genDashboardCmd 生成Grafana仪表盘
+var genDashboardCmd = &cobra.Command{
+	Use:   "dashboard",
+	Short: "生成Grafana仪表盘",
+	Long: `生成以下面板，没有注册的指标不生成相应的面板：
+	- 请求 : 各路由的请求速率、5xx比例、处理中的请求数
+	- 延时 : 处理时间和延时的热力图、p50/p90/p99（附带exemplar）
+	- SLO : 错误预算的剩余比例和燃烧率
+	- 运行时 : CPU、内存、协程、GC、文件描述符
+	- 生命周期 : 各状态的Pod数、运行时间、各版本的Pod数
+仪表盘带有数据源（datasource）和命名空间（namespace）变量。
+
+例：
+	homework gen dashboard --config config.yaml -o grafana-dashboard/httpserver.json`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return execGenDashboard()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(genCmd)
+	genCmd.AddCommand(genRulesCmd)
+	genCmd.AddCommand(genDashboardCmd)
+
+	genCmd.PersistentFlags().StringVarP(&genOutput, "output", "o", "", "输出的文件，默认输出到标准输出")
+
+	genRulesCmd.Flags().StringVar(&rulesFormat, "format", rulesFormatRules, "格式：rules（rule_files）/prometheusrule（Prometheus Operator）")
+	genRulesCmd.Flags().StringVar(&rulesName, "name", "httpserver", "prometheusrule：资源名")
+	genRulesCmd.Flags().StringVar(&rulesNamespace, "namespace", "", "prometheusrule：命名空间")
+	genRulesCmd.Flags().StringToStringVar(&rulesLabels, "labels", nil, "prometheusrule：资源的标签，需和Prometheus的ruleSelector一致，如 release=prometheus")
+	genRulesCmd.Flags().StringVar(&rulesOptions.Selector, "selector", "", `追加到所有指标的标签选择器，如 namespace="default"`)
+	genRulesCmd.Flags().DurationVar(&rulesOptions.LatencyThreshold, "latency-threshold", 0, "p99延时告警的阈值，默认使用延时SLO中最小的threshold，没有时为1s")
+	genRulesCmd.Flags().Float64Var(&rulesOptions.ErrorRatio, "error-ratio", 0, "5xx比例告警的阈值，默认0.05")
+	genRulesCmd.Flags().DurationVar(&rulesOptions.For, "for", 0, "条件持续多久后告警，默认5m")
+
+	genDashboardCmd.Flags().StringVar(&dashboardOptions.Title, "title", "Http Server", "仪表盘的标题")
+	genDashboardCmd.Flags().StringVar(&dashboardOptions.UID, "uid", "httpserver", "仪表盘的UID")
+}
+
+func execGenRules() error {
+	cfg, err := service.LoadConfig()
+	if err != nil {
+		return err
+	}
+	r, _, err := service.LoadRegistry(cfg)
+	if err != nil {
+		return err
+	}
+
+	rules := metrics.GenerateRules(r, rulesOptions)
+	var out interface{} = rules
+	switch rulesFormat {
+	case rulesFormatRules:
+	case rulesFormatPrometheusRule:
+		out = metrics.NewPrometheusRule(rulesName, rulesNamespace, rulesLabels, rules)
+	default:
+		return fmt.Errorf("format %q not supported", rulesFormat)
+	}
+
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(out); err != nil {
+		return err
+	}
+	return writeOutput(b.Bytes())
+}
+
+func execGenDashboard() error {
+	cfg, err := service.LoadConfig()
+	if err != nil {
+		return err
+	}
+	r, _, err := service.LoadRegistry(cfg)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(metrics.GenerateDashboard(r, dashboardOptions), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeOutput(append(b, '\n'))
+}
+
+// writeOutput 输出到 --output 指定的文件或标准输出
+func writeOutput(b []byte) error {
+	if genOutput == "" || genOutput == "-" {
+		_, err := os.Stdout.Write(b)
+		return err
+	}
+	return os.WriteFile(genOutput, b, 0o644)
+}
@@ -2,12 +2,14 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
 
 	"github.com/kabacloud/cloudnativehomework4-module10/environment"
+	"github.com/kabacloud/cloudnativehomework4-module10/service"
 	"github.com/spf13/viper"
 )
 
@@ -16,6 +18,9 @@ var (
 	MainContext context.Context
 )
 
+// 没有指定 --config 且 $HOME 下没有配置文件时使用的当前目录的配置文件，Docker镜像中和可执行文件一起复制到工作目录
+const defaultConfigFile = "config.yaml"
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   environment.AppName(),
@@ -36,7 +41,12 @@ var rootCmd = &cobra.Command{
 可访问URL:
   - 存活探针 : http://localhost:8000/healthz
   - 就绪探针 : http://localhost:8000/readyz
-  - 打印服务信息 : http://localhost:8000/info`,
+  - 打印服务信息 : http://localhost:8000/info
+  - 回显请求 : http://localhost:8000/echo
+  - 构建信息 : http://localhost:8000/version`,
+	// 配置错误等执行中的错误只输出错误信息，不输出用法。错误由 Execute 中的 cobra.CheckErr 输出一次
+	SilenceUsage:  true,
+	SilenceErrors: true,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
@@ -56,7 +66,7 @@ func init() {
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.homework20210925.yaml)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.homework20210925.yaml, then ./config.yaml)")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -79,10 +89,16 @@ func initConfig() {
 		viper.SetConfigName(".homework20210925")
 	}
 
-	viper.AutomaticEnv() // read in environment variables that match
+	service.BindEnv() // read in environment variables that match
 
 	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
+	err := viper.ReadInConfig()
+	var notFound viper.ConfigFileNotFoundError
+	if cfgFile == "" && errors.As(err, &notFound) {
+		viper.SetConfigFile(defaultConfigFile)
+		err = viper.ReadInConfig()
+	}
+	if err == nil {
 		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
 }
@@ -13,9 +13,11 @@ var serveCmd = &cobra.Command{
 	- 存活探针 : /healthz
 	- 就绪探针 : /readyz
 	- 监控指标 : /metrics
-	- 打印服务信息 : /info`,
-	Run: func(cmd *cobra.Command, args []string) {
-		execServe(args)
+	- 打印服务信息 : /info
+	- 回显请求 : /echo
+	- 构建信息 : /version`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return execServe(args)
 	},
 }
 
@@ -33,6 +35,7 @@ func init() {
 	// serveCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
 
-func execServe(args []string) {
-	_ = service.Start(MainContext)
+// execServe 启动服务，配置错误（如未知的执行环境）时返回错误，以非0的退出码结束
+func execServe(args []string) error {
+	return service.Start(MainContext)
 }
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/environment"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var versionFormat string // 输出的格式
+
+// versionCmd 打印构建信息
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "打印构建信息",
+	Long: `打印应用名、版本、git版本sha1码、编译时间、是否有未提交的修改和Go版本。
+编译阶段没有注入的项目从Go的构建信息（debug.ReadBuildInfo）中补充。
+
+例：
+	homework version --format json`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return execVersion()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(versionCmd)
+
+	versionCmd.Flags().StringVar(&versionFormat, "format", "text", "格式：text/json/yaml")
+}
+
+func execVersion() error {
+	switch versionFormat {
+	case "text":
+		fmt.Print(environment.Build)
+		return nil
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(environment.Build)
+	case "yaml":
+		enc := yaml.NewEncoder(os.Stdout)
+		enc.SetIndent(2)
+		return enc.Encode(environment.Build)
+	default:
+		return fmt.Errorf("format %q not supported", versionFormat)
+	}
+}
@@ -0,0 +1,158 @@
+package environment
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// BuildTime 编译阶段注入的编译时间，RFC3339格式
+var BuildTime string
+
+// BuildMeta 从编译阶段注入的信息解析的构建信息，缺少的项目由 debug.ReadBuildInfo 补充
+type BuildMeta struct {
+	Name      string `json:"name" yaml:"name"`                               // 应用名
+	Version   string `json:"version" yaml:"version"`                         // 版本
+	Commit    string `json:"commit" yaml:"commit"`                           // git版本sha1码
+	BuildTime string `json:"buildTime,omitempty" yaml:"buildTime,omitempty"` // 编译时间（RFC3339），没有时为提交时间
+	Dirty     bool   `json:"dirty" yaml:"dirty"`                             // 编译时工作区是否有未提交的修改
+	GoVersion string `json:"goVersion" yaml:"goVersion"`                     // 编译使用的Go版本
+	Module    string `json:"module,omitempty" yaml:"module,omitempty"`       // 主模块的路径
+}
+
+// Build 当前程序的构建信息
+var Build BuildMeta
+
+// commitPattern git的sha1码（短码或完整）
+var commitPattern = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+func init() {
+	Build = parseBuildInfo(BuildInfo)
+	if Version != "" {
+		Build.Version = Version
+	}
+	if CommitID != "" {
+		Build.Commit = CommitID
+	}
+	if BuildTime != "" {
+		Build.BuildTime = BuildTime
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		Build.merge(info)
+	}
+	if Build.GoVersion == "" {
+		Build.GoVersion = runtime.Version()
+	}
+	if Build.Name == "" {
+		Build.Name = AppName()
+	}
+	// 未注入的版本和sha1码使用解析后的值
+	if Version == "" {
+		Version = Build.Version
+	}
+	if CommitID == "" {
+		CommitID = Build.Commit
+	}
+}
+
+// parseBuildInfo 解析编译阶段注入的信息，支持以下格式：
+//   - 应用名@版本号-sha1码[-dirty]（makefile的格式）
+//   - 应用名:版本号[换行]Commit:sha1码
+func parseBuildInfo(s string) BuildMeta {
+	var b BuildMeta
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return b
+	}
+
+	if name, rest, ok := strings.Cut(s, "@"); ok && !strings.Contains(s, "\n") {
+		b.Name = name
+		if trimmed, ok := strings.CutSuffix(rest, "-dirty"); ok {
+			rest, b.Dirty = trimmed, true
+		}
+		if i := strings.LastIndex(rest, "-"); i >= 0 && commitPattern.MatchString(rest[i+1:]) {
+			rest, b.Commit = rest[:i], rest[i+1:]
+		}
+		b.Version = rest
+		return b
+	}
+
+	for _, line := range strings.Split(s, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(key) {
+		case "commit":
+			if trimmed, ok := strings.CutSuffix(value, "-dirty"); ok {
+				value, b.Dirty = trimmed, true
+			}
+			b.Commit = value
+		case "build time", "buildtime":
+			b.BuildTime = value
+		default:
+			if b.Name == "" {
+				b.Name, b.Version = key, value
+			}
+		}
+	}
+	return b
+}
+
+// merge 用 debug.ReadBuildInfo 补充缺少的项目
+func (b *BuildMeta) merge(info *debug.BuildInfo) {
+	b.GoVersion = info.GoVersion
+	b.Module = info.Main.Path
+	if b.Version == "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		b.Version = info.Main.Version
+	}
+
+	settings := map[string]string{}
+	for _, s := range info.Settings {
+		settings[s.Key] = s.Value
+	}
+	if b.Commit == "" {
+		b.Commit = settings["vcs.revision"]
+		// 注入的信息中没有sha1码时，是否有未提交的修改也以VCS的信息为准
+		if settings["vcs.modified"] == "true" {
+			b.Dirty = true
+		}
+	}
+	if b.BuildTime == "" {
+		b.BuildTime = settings["vcs.time"]
+	}
+}
+
+// String 以文本输出构建信息
+func (b BuildMeta) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s\n", orUnknown(b.Name), orUnknown(b.Version))
+	commit := orUnknown(b.Commit)
+	if b.Dirty {
+		commit += " (dirty)"
+	}
+	fmt.Fprintf(&sb, "Commit:\t\t%s\n", commit)
+	if b.BuildTime != "" {
+		buildTime := b.BuildTime
+		if t, err := time.Parse(time.RFC3339, b.BuildTime); err == nil {
+			buildTime = t.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(&sb, "Build time:\t%s\n", buildTime)
+	}
+	fmt.Fprintf(&sb, "Go version:\t%s\n", b.GoVersion)
+	if b.Module != "" {
+		fmt.Fprintf(&sb, "Module:\t\t%s\n", b.Module)
+	}
+	return sb.String()
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
@@ -0,0 +1,53 @@
+package environment
+
+import (
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnit_parseBuildInfo(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(BuildMeta{Name: "httpserver", Version: "v0.4.0", Commit: "abc1234"}, parseBuildInfo("httpserver@v0.4.0-abc1234"))
+	assert.Equal(BuildMeta{Name: "httpserver", Version: "v1.0.0-rc1", Commit: "abc1234", Dirty: true}, parseBuildInfo("httpserver@v1.0.0-rc1-abc1234-dirty"))
+	assert.Equal(BuildMeta{Name: "httpserver", Version: "v1.0.0-rc1"}, parseBuildInfo("httpserver@v1.0.0-rc1"))
+	assert.Equal(BuildMeta{Name: "httpserver", Version: "v0.3.0", Commit: "abc1234"}, parseBuildInfo("httpserver:v0.3.0\nCommit:abc1234"))
+	assert.Equal(BuildMeta{}, parseBuildInfo(""))
+}
+
+func TestUnit_mergeBuildInfo(t *testing.T) {
+	assert := assert.New(t)
+
+	info := &debug.BuildInfo{
+		GoVersion: "go1.23.0",
+		Main:      debug.Module{Path: "example.com/app", Version: "v1.2.3"},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "0123456789abcdef"},
+			{Key: "vcs.time", Value: "2021-09-25T00:00:00Z"},
+			{Key: "vcs.modified", Value: "true"},
+		},
+	}
+
+	// 注入的信息优先
+	b := parseBuildInfo("httpserver@v0.4.0-abc1234")
+	b.merge(info)
+	assert.Equal(BuildMeta{
+		Name: "httpserver", Version: "v0.4.0", Commit: "abc1234", BuildTime: "2021-09-25T00:00:00Z",
+		GoVersion: "go1.23.0", Module: "example.com/app",
+	}, b)
+
+	// 没有注入时全部使用Go的构建信息
+	b = BuildMeta{}
+	b.merge(info)
+	assert.Equal("v1.2.3", b.Version)
+	assert.Equal("0123456789abcdef", b.Commit)
+	assert.True(b.Dirty)
+	assert.Contains(b.String(), "0123456789abcdef (dirty)")
+
+	info.Main.Version = "(devel)"
+	b = BuildMeta{}
+	b.merge(info)
+	assert.Equal("", b.Version)
+}
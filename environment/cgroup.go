@@ -0,0 +1,119 @@
+package environment
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// cgroup的挂载目录。容器中启用了cgroup命名空间时即为容器自身的cgroup
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cgroup v1 中内存不限制时 memory.limit_in_bytes 为接近int64最大值的数，超过该值视为不限制
+const unlimitedMemoryV1 = int64(1) << 62
+
+// Resources 容器的资源限制和使用量，从cgroup v1/v2读取。不在容器中或没有限制时为0
+type Resources struct {
+	CgroupVersion int     `json:"cgroupVersion" yaml:"cgroupVersion"` // cgroup的版本：1/2，读取不到时为0
+	CPUQuota      float64 `json:"cpuQuota" yaml:"cpuQuota"`           // CPU的上限（核数），如 limits.cpu: 250m 时为0.25
+	MemoryLimit   int64   `json:"memoryLimit" yaml:"memoryLimit"`     // 内存的上限（字节）
+	MemoryUsage   int64   `json:"memoryUsage" yaml:"memoryUsage"`     // 当前的内存使用量（字节），含页缓存
+	GoMemoryLimit int64   `json:"goMemoryLimit" yaml:"goMemoryLimit"` // Go运行时的软内存上限（GOMEMLIMIT），不限制时为0
+}
+
+// RuntimeOptions Go运行时的配置
+type RuntimeOptions struct {
+	AutoMemoryLimit     bool    `mapstructure:"automemorylimit"`     // 是否按容器的内存上限设定GOMEMLIMIT，设定了环境变量GOMEMLIMIT时以环境变量为准
+	MemoryLimitHeadroom float64 `mapstructure:"memorylimitheadroom"` // 为非Go堆内存预留的比例（0~1），GOMEMLIMIT = 容器的内存上限 ×（1 - 该值）
+}
+
+// ReadResources 读取容器当前的资源限制和使用量
+func ReadResources() Resources {
+	r := readCgroup(cgroupRoot)
+	if limit := debug.SetMemoryLimit(-1); limit != math.MaxInt64 {
+		r.GoMemoryLimit = limit
+	}
+	return r
+}
+
+// ApplyMemoryLimit 按容器的内存上限设定Go运行时的软内存上限，返回设定的值。
+// 设定了环境变量GOMEMLIMIT、未开启或容器没有内存上限时不设定，返回0
+func ApplyMemoryLimit(opts RuntimeOptions) (int64, error) {
+	return applyMemoryLimit(opts, cgroupRoot)
+}
+
+// applyMemoryLimit 按root下cgroup的内存上限设定软内存上限
+func applyMemoryLimit(opts RuntimeOptions, root string) (int64, error) {
+	if opts.MemoryLimitHeadroom < 0 || opts.MemoryLimitHeadroom >= 1 {
+		return 0, fmt.Errorf("memory limit headroom %v must be in [0, 1)", opts.MemoryLimitHeadroom)
+	}
+	if !opts.AutoMemoryLimit || os.Getenv("GOMEMLIMIT") != "" {
+		return 0, nil
+	}
+	limit := readCgroup(root).MemoryLimit
+	if limit <= 0 {
+		return 0, nil
+	}
+	soft := int64(float64(limit) * (1 - opts.MemoryLimitHeadroom))
+	debug.SetMemoryLimit(soft)
+	return soft, nil
+}
+
+// readCgroup 从cgroup的挂载目录读取资源限制和使用量，有 cgroup.controllers 文件时为v2
+func readCgroup(root string) Resources {
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		return readCgroupV2(root)
+	}
+	return readCgroupV1(root)
+}
+
+// readCgroupV2 cpu.max 的格式为 “配额 周期” 或 “max 周期”，memory.max 为字节数或 max
+func readCgroupV2(root string) Resources {
+	r := Resources{CgroupVersion: 2}
+	if fields := strings.Fields(readTrimmed(filepath.Join(root, "cpu.max"))); len(fields) == 2 && fields[0] != "max" {
+		quota, err1 := strconv.ParseFloat(fields[0], 64)
+		period, err2 := strconv.ParseFloat(fields[1], 64)
+		if err1 == nil && err2 == nil && period > 0 {
+			r.CPUQuota = quota / period
+		}
+	}
+	if limit, ok := readInt(filepath.Join(root, "memory.max")); ok {
+		r.MemoryLimit = limit
+	}
+	r.MemoryUsage, _ = readInt(filepath.Join(root, "memory.current"))
+	return r
+}
+
+// readCgroupV1 CPU在 cpu 或 cpu,cpuacct 目录，配额为-1时不限制；内存在 memory 目录
+func readCgroupV1(root string) Resources {
+	var r Resources
+	for _, dir := range []string{"cpu", "cpu,cpuacct"} {
+		quota, ok1 := readInt(filepath.Join(root, dir, "cpu.cfs_quota_us"))
+		period, ok2 := readInt(filepath.Join(root, dir, "cpu.cfs_period_us"))
+		if ok1 && ok2 {
+			r.CgroupVersion = 1
+			if quota > 0 && period > 0 {
+				r.CPUQuota = float64(quota) / float64(period)
+			}
+			break
+		}
+	}
+	if limit, ok := readInt(filepath.Join(root, "memory", "memory.limit_in_bytes")); ok {
+		r.CgroupVersion = 1
+		if limit < unlimitedMemoryV1 {
+			r.MemoryLimit = limit
+		}
+		r.MemoryUsage, _ = readInt(filepath.Join(root, "memory", "memory.usage_in_bytes"))
+	}
+	return r
+}
+
+// readInt 读取只有一个整数的文件，文件不存在或值为 max 时返回false
+func readInt(path string) (int64, bool) {
+	v, err := strconv.ParseInt(readTrimmed(path), 10, 64)
+	return v, err == nil
+}
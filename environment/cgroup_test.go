@@ -0,0 +1,100 @@
+package environment
+
+import (
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeFiles 在dir下生成文件，键为相对路径
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+}
+
+func TestUnit_readCgroup(t *testing.T) {
+	assert := assert.New(t)
+
+	v2 := t.TempDir()
+	writeFiles(t, v2, map[string]string{
+		"cgroup.controllers": "cpu memory",
+		"cpu.max":            "25000 100000\n",
+		"memory.max":         "52428800\n",
+		"memory.current":     "1048576\n",
+	})
+	assert.Equal(Resources{CgroupVersion: 2, CPUQuota: 0.25, MemoryLimit: 52428800, MemoryUsage: 1048576}, readCgroup(v2))
+
+	unlimitedV2 := t.TempDir()
+	writeFiles(t, unlimitedV2, map[string]string{
+		"cgroup.controllers": "cpu memory",
+		"cpu.max":            "max 100000\n",
+		"memory.max":         "max\n",
+		"memory.current":     "1048576\n",
+	})
+	assert.Equal(Resources{CgroupVersion: 2, MemoryUsage: 1048576}, readCgroup(unlimitedV2))
+
+	v1 := t.TempDir()
+	writeFiles(t, v1, map[string]string{
+		"cpu,cpuacct/cpu.cfs_quota_us":  "50000\n",
+		"cpu,cpuacct/cpu.cfs_period_us": "100000\n",
+		"memory/memory.limit_in_bytes":  "9223372036854771712\n",
+		"memory/memory.usage_in_bytes":  "2097152\n",
+	})
+	assert.Equal(Resources{CgroupVersion: 1, CPUQuota: 0.5, MemoryUsage: 2097152}, readCgroup(v1))
+
+	assert.Equal(Resources{}, readCgroup(t.TempDir()))
+}
+
+func TestUnit_applyMemoryLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	saved := debug.SetMemoryLimit(-1)
+	defer debug.SetMemoryLimit(saved)
+
+	_, err := ApplyMemoryLimit(RuntimeOptions{AutoMemoryLimit: true, MemoryLimitHeadroom: 1})
+	assert.Error(err)
+
+	// 未开启时不设定
+	limit, err := ApplyMemoryLimit(RuntimeOptions{MemoryLimitHeadroom: 0.1})
+	assert.NoError(err)
+	assert.Equal(int64(0), limit)
+	assert.Equal(saved, debug.SetMemoryLimit(-1))
+
+	// 容器的内存上限为50Mi时预留10%
+	t.Setenv("GOMEMLIMIT", "")
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"cgroup.controllers": "memory",
+		"memory.max":         "52428800\n",
+	})
+	limit, err = applyMemoryLimit(RuntimeOptions{AutoMemoryLimit: true, MemoryLimitHeadroom: 0.1}, root)
+	assert.NoError(err)
+	assert.Equal(int64(47185920), limit)
+	assert.Equal(int64(47185920), debug.SetMemoryLimit(-1))
+
+	// 没有内存上限时不设定
+	limit, err = applyMemoryLimit(RuntimeOptions{AutoMemoryLimit: true, MemoryLimitHeadroom: 0.1}, t.TempDir())
+	assert.NoError(err)
+	assert.Equal(int64(0), limit)
+
+	// 设定了环境变量GOMEMLIMIT时以环境变量为准
+	t.Setenv("GOMEMLIMIT", "100MiB")
+	limit, err = applyMemoryLimit(RuntimeOptions{AutoMemoryLimit: true, MemoryLimitHeadroom: 0.1}, root)
+	assert.NoError(err)
+	assert.Equal(int64(0), limit)
+}
+
+func TestUnit_formatBytes(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("512", formatBytes(512))
+	assert.Equal("1.5Ki", formatBytes(1536))
+	assert.Equal("50.0Mi", formatBytes(50<<20))
+	assert.Equal("2.0Gi", formatBytes(2<<30))
+}
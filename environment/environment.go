@@ -4,13 +4,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
 var (
-	BuildInfo string // 编译阶段注入的信息。格式：应用名:版本号[换行]Commit:git版本sha1码
-	Version   string // 版本
-	CommitID  string // 编译阶段注入的git版本sha1码
+	BuildInfo string // 编译阶段注入的信息。格式：应用名@版本号-sha1码[-dirty] 或 应用名:版本号[换行]Commit:git版本sha1码
+	Version   string // 编译阶段注入的版本，未注入时为从构建信息解析的值
+	CommitID  string // 编译阶段注入的git版本sha1码，未注入时为从构建信息解析的值
 
 	StartTime time.Time // 应用启动时间
 	Hostname  string    // 节点主机名
@@ -33,36 +34,100 @@ func init() {
 	if err != nil {
 		panic(err)
 	}
-	// 获取当前环境
+	// 获取当前环境，读取配置前先使用同名的内置配置，未知的环境由 LoadProfile 判定
 	ExecENV = os.Getenv(envKey)
-	if !IsProduction() && !IsDevelopment() && !IsLocalhost() {
-		// 默认环境为单机环境
-		// ExecENV = envLocalhost
+	if p, ok := findProfile(builtinProfiles(), ExecENV); ok {
+		ExecProfile = p
 	}
 }
 
 // 是否处于生产集群环境
 func IsProduction() bool {
-	return ExecENV == envProduction
+	return ExecProfile.Production != nil && *ExecProfile.Production
 }
 
 // 是否处于开发集群环境
 func IsDevelopment() bool {
-	return ExecENV == envDevelopment
+	return strings.EqualFold(ExecProfile.Name, envDevelopment)
 }
 
 // 是否处于单机环境
 func IsLocalhost() bool {
-	return ExecENV == envLocalhost
+	return ExecProfile.Localhost != nil && *ExecProfile.Localhost
 }
 
-// 程序信息
-func AppInfo() string {
-	return fmt.Sprintf("%s\n", BuildInfo) +
-		fmt.Sprintf("Hostname:\t%s\n", Hostname) +
-		fmt.Sprintf("Environment:\t%s\n", ExecENV) +
-		fmt.Sprintf("Start time:\t%s\n", StartTime.Format("2006-01-02 15:04:05")) +
-		fmt.Sprintf("Running time:\t%s\n", time.Since(StartTime))
+// AppInfo 程序信息
+type AppInfo struct {
+	Name          string    `json:"name" yaml:"name"`                   // 可执行文件名
+	BuildInfo     string    `json:"buildInfo" yaml:"buildInfo"`         // 编译阶段注入的信息
+	Version       string    `json:"version" yaml:"version"`             // 版本
+	CommitID      string    `json:"commitID" yaml:"commitID"`           // git版本sha1码
+	Hostname      string    `json:"hostname" yaml:"hostname"`           // 节点主机名
+	Environment   string    `json:"environment" yaml:"environment"`     // 执行环境
+	Profile       string    `json:"profile" yaml:"profile"`             // 执行环境使用的配置，HWENV未知时为fallback的配置
+	StartTime     time.Time `json:"startTime" yaml:"startTime"`         // 启动时间
+	Uptime        string    `json:"uptime" yaml:"uptime"`               // 运行时间，如 1h2m3.5s
+	UptimeSeconds float64   `json:"uptimeSeconds" yaml:"uptimeSeconds"` // 运行时间的秒数
+	Pod           PodMeta   `json:"pod" yaml:"pod"`                     // 在k8s中执行时Pod的元数据
+	Resources     Resources `json:"resources" yaml:"resources"`         // 容器的资源限制和使用量
+}
+
+// Info 当前的程序信息
+func Info() AppInfo {
+	uptime := time.Since(StartTime)
+	return AppInfo{
+		Name:          AppName(),
+		BuildInfo:     BuildInfo,
+		Version:       Version,
+		CommitID:      CommitID,
+		Hostname:      Hostname,
+		Environment:   ExecENV,
+		Profile:       ExecProfile.Name,
+		StartTime:     StartTime,
+		Uptime:        uptime.String(),
+		UptimeSeconds: uptime.Seconds(),
+		Pod:           Pod,
+		Resources:     ReadResources(),
+	}
+}
+
+// String 以制表符分隔的文本输出程序信息，在k8s中执行时追加Pod的信息
+func (a AppInfo) String() string {
+	s := fmt.Sprintf("%s\n", a.BuildInfo) +
+		fmt.Sprintf("Hostname:\t%s\n", a.Hostname) +
+		fmt.Sprintf("Environment:\t%s\n", a.Environment) +
+		fmt.Sprintf("Start time:\t%s\n", a.StartTime.Format("2006-01-02 15:04:05")) +
+		fmt.Sprintf("Running time:\t%s\n", a.Uptime)
+	if a.Profile != "" && a.Profile != a.Environment {
+		s += fmt.Sprintf("Profile:\t%s\n", a.Profile)
+	}
+	if a.Pod.Name != "" {
+		s += fmt.Sprintf("Pod:\t\t%s/%s\n", a.Pod.Namespace, a.Pod.Name)
+	}
+	if a.Pod.NodeName != "" {
+		s += fmt.Sprintf("Node:\t\t%s\n", a.Pod.NodeName)
+	}
+	if a.Resources.CPUQuota > 0 {
+		s += fmt.Sprintf("CPU limit:\t%g\n", a.Resources.CPUQuota)
+	}
+	if a.Resources.MemoryLimit > 0 {
+		s += fmt.Sprintf("Memory:\t\t%s / %s\n", formatBytes(a.Resources.MemoryUsage), formatBytes(a.Resources.MemoryLimit))
+	}
+	return s
+}
+
+// formatBytes 以 Ki/Mi/Gi 输出字节数，和k8s的资源单位一致
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 2; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ci", float64(n)/float64(div), "KMG"[exp])
 }
 
 func AppName() string {
@@ -0,0 +1,149 @@
+package environment
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Downward API 卷的默认挂载目录，可通过环境变量 PODINFO_DIR 修改
+	defaultPodInfoDir = "/etc/podinfo"
+	// ServiceAccount 的令牌等的挂载目录，其中的 namespace 文件为Pod所在的命名空间
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+// 输出的注解的允许列表，逗号分隔，以*结尾时为前缀匹配，如 "team,example.com/*"。
+// 注解中常有sidecar和密钥注入的配置，而Pod的元数据会从 /info 和 /echo 公开，所以默认不输出任何注解
+const annotationsAllowEnv = "POD_ANNOTATIONS_ALLOW"
+
+// PodMeta 在k8s中执行时Pod的元数据，通过 Downward API 的环境变量和卷取得，不在k8s中时为空
+type PodMeta struct {
+	Name           string            `json:"name,omitempty" yaml:"name,omitempty"`                     // 环境变量 POD_NAME 或卷中的 name 文件
+	Namespace      string            `json:"namespace,omitempty" yaml:"namespace,omitempty"`           // 环境变量 POD_NAMESPACE、卷中的 namespace 文件或ServiceAccount的命名空间
+	UID            string            `json:"uid,omitempty" yaml:"uid,omitempty"`                       // 环境变量 POD_UID 或卷中的 uid 文件
+	IP             string            `json:"ip,omitempty" yaml:"ip,omitempty"`                         // 环境变量 POD_IP
+	NodeName       string            `json:"nodeName,omitempty" yaml:"nodeName,omitempty"`             // 环境变量 NODE_NAME
+	ServiceAccount string            `json:"serviceAccount,omitempty" yaml:"serviceAccount,omitempty"` // 环境变量 POD_SERVICE_ACCOUNT
+	Labels         map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`                 // 卷中的 labels 文件
+	Annotations    map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`       // 卷中的 annotations 文件，只有环境变量 POD_ANNOTATIONS_ALLOW 允许的注解
+}
+
+// Pod 当前Pod的元数据
+var Pod = loadPod(os.Getenv, podInfoDir(), serviceAccountDir)
+
+// LogFields 附加到所有日志的字段：Pod名、命名空间和节点名，没有的项目不附加
+func (p PodMeta) LogFields() map[string]string {
+	fields := map[string]string{}
+	for k, v := range map[string]string{"pod": p.Name, "namespace": p.Namespace, "node": p.NodeName} {
+		if v != "" {
+			fields[k] = v
+		}
+	}
+	return fields
+}
+
+// ResourceAttributes OpenTelemetry 语义约定的k8s资源属性，Pod的标签以 k8s.pod.label.<key> 输出
+func (p PodMeta) ResourceAttributes() map[string]string {
+	attrs := map[string]string{}
+	for k, v := range map[string]string{
+		"k8s.pod.name":       p.Name,
+		"k8s.namespace.name": p.Namespace,
+		"k8s.pod.uid":        p.UID,
+		"k8s.node.name":      p.NodeName,
+	} {
+		if v != "" {
+			attrs[k] = v
+		}
+	}
+	for k, v := range p.Labels {
+		attrs["k8s.pod.label."+k] = v
+	}
+	return attrs
+}
+
+// podInfoDir Downward API 卷的挂载目录
+func podInfoDir() string {
+	if dir := os.Getenv("PODINFO_DIR"); dir != "" {
+		return dir
+	}
+	return defaultPodInfoDir
+}
+
+// loadPod 环境变量优先，没有时读取 Downward API 卷中的文件
+func loadPod(getenv func(string) string, dir, saDir string) PodMeta {
+	or := func(env, file string) string {
+		if v := getenv(env); v != "" {
+			return v
+		}
+		return readTrimmed(filepath.Join(dir, file))
+	}
+	p := PodMeta{
+		Name:           or("POD_NAME", "name"),
+		Namespace:      or("POD_NAMESPACE", "namespace"),
+		UID:            or("POD_UID", "uid"),
+		IP:             getenv("POD_IP"),
+		NodeName:       getenv("NODE_NAME"),
+		ServiceAccount: getenv("POD_SERVICE_ACCOUNT"),
+		Labels:         readDownwardMap(filepath.Join(dir, "labels")),
+		Annotations:    allowAnnotations(readDownwardMap(filepath.Join(dir, "annotations")), getenv(annotationsAllowEnv)),
+	}
+	if p.Namespace == "" {
+		p.Namespace = readTrimmed(filepath.Join(saDir, "namespace"))
+	}
+	return p
+}
+
+// allowAnnotations 只保留允许列表中的注解
+func allowAnnotations(annotations map[string]string, allow string) map[string]string {
+	var allowed map[string]string
+	for _, pattern := range strings.Split(allow, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		for k, v := range annotations {
+			if k == pattern || (strings.HasSuffix(pattern, "*") && strings.HasPrefix(k, strings.TrimSuffix(pattern, "*"))) {
+				if allowed == nil {
+					allowed = map[string]string{}
+				}
+				allowed[k] = v
+			}
+		}
+	}
+	return allowed
+}
+
+// readTrimmed 读取文件的内容，文件不存在时返回空串
+func readTrimmed(path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// readDownwardMap 读取 Downward API 卷中标签和注解的文件，每行的格式为 key="value"，值以Go的字符串字面量转义
+func readDownwardMap(path string) map[string]string {
+	b, err := os.ReadFile(path)
+	if err != nil || len(bytes.TrimSpace(b)) == 0 {
+		return nil
+	}
+	m := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(b)+1)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		m[key] = value
+	}
+	return m
+}
@@ -0,0 +1,56 @@
+package environment
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnit_loadPod(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, saDir := t.TempDir(), t.TempDir()
+	assert.NoError(os.WriteFile(filepath.Join(dir, "labels"), []byte("app=\"httpserver\"\npod-template-hash=\"5d8f7\"\n"), 0o644))
+	assert.NoError(os.WriteFile(filepath.Join(dir, "annotations"), []byte(
+		"note=\"line1\\nline2\"\nteam.example.com/owner=\"sre\"\nvault.hashicorp.com/agent-inject-secret-db=\"db/creds\"\n"), 0o644))
+	assert.NoError(os.WriteFile(filepath.Join(dir, "uid"), []byte("1234-abcd\n"), 0o644))
+	assert.NoError(os.WriteFile(filepath.Join(saDir, "namespace"), []byte("homework"), 0o644))
+
+	env := map[string]string{
+		"POD_NAME": "httpserver-5d8f7-xyz", "NODE_NAME": "node-1", "POD_IP": "10.1.2.3", "POD_SERVICE_ACCOUNT": "default",
+		"POD_ANNOTATIONS_ALLOW": "note, team.example.com/*",
+	}
+	p := loadPod(func(k string) string { return env[k] }, dir, saDir)
+	assert.Equal(PodMeta{
+		Name:           "httpserver-5d8f7-xyz",
+		Namespace:      "homework",
+		UID:            "1234-abcd",
+		IP:             "10.1.2.3",
+		NodeName:       "node-1",
+		ServiceAccount: "default",
+		Labels:         map[string]string{"app": "httpserver", "pod-template-hash": "5d8f7"},
+		Annotations:    map[string]string{"note": "line1\nline2", "team.example.com/owner": "sre"},
+	}, p)
+
+	assert.Equal(map[string]string{"pod": "httpserver-5d8f7-xyz", "namespace": "homework", "node": "node-1"}, p.LogFields())
+	attrs := p.ResourceAttributes()
+	assert.Equal("httpserver-5d8f7-xyz", attrs["k8s.pod.name"])
+	assert.Equal("homework", attrs["k8s.namespace.name"])
+	assert.Equal("httpserver", attrs["k8s.pod.label.app"])
+
+	// 没有允许列表时不输出注解
+	delete(env, "POD_ANNOTATIONS_ALLOW")
+	assert.Nil(loadPod(func(k string) string { return env[k] }, dir, saDir).Annotations)
+
+	// 环境变量优先于卷中的文件
+	env["POD_NAMESPACE"] = "other"
+	assert.Equal("other", loadPod(func(k string) string { return env[k] }, dir, saDir).Namespace)
+
+	// 不在k8s中时为空
+	empty := loadPod(func(string) string { return "" }, t.TempDir(), t.TempDir())
+	assert.Equal(PodMeta{}, empty)
+	assert.Empty(empty.LogFields())
+	assert.Empty(empty.ResourceAttributes())
+}
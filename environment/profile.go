@@ -0,0 +1,125 @@
+package environment
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ExecProfile 当前执行环境的配置，由 LoadProfile 按环境变量HWENV选定
+var ExecProfile Profile
+
+// Profile 执行环境的配置，覆盖各配置节点的默认值，未设定的项目不覆盖
+type Profile struct {
+	Name       string `mapstructure:"-"`          // 配置名，内置的配置为 Production/Develop/Localhost，其他为配置文件中的键名
+	Production *bool  `mapstructure:"production"` // 是否为生产环境
+	Localhost  *bool  `mapstructure:"localhost"`  // 是否为单机环境，控制台默认使用带颜色的格式，打印请求头
+	LogLevel   string `mapstructure:"loglevel"`   // 覆盖 log.level
+	Chaos      *bool  `mapstructure:"chaos"`      // 覆盖 chaos.enabled
+	HeaderEcho string `mapstructure:"headerecho"` // 覆盖 requestheader.echo：all/redact/none
+}
+
+// ProfileOptions 执行环境的配置
+type ProfileOptions struct {
+	Default  string             `mapstructure:"default"`  // 没有设定HWENV时使用的配置，为空时不使用任何配置
+	Fallback string             `mapstructure:"fallback"` // HWENV不是已知的配置时使用的配置，为空时启动失败
+	Profiles map[string]Profile `mapstructure:"profiles"` // 追加的配置，如 staging、canary，和内置的配置同名时只覆盖设定的项目
+}
+
+// builtinProfiles 以前以常量区分的三个执行环境，每次生成新的配置，合并时不影响其他调用
+func builtinProfiles() map[string]Profile {
+	enabled := true
+	return map[string]Profile{
+		envProduction:  {Production: &enabled},
+		envDevelopment: {},
+		envLocalhost:   {Localhost: &enabled},
+	}
+}
+
+// merge 以o中设定的项目覆盖p，返回合并后的配置
+func (p Profile) merge(o Profile) Profile {
+	if o.Production != nil {
+		p.Production = o.Production
+	}
+	if o.Localhost != nil {
+		p.Localhost = o.Localhost
+	}
+	if o.LogLevel != "" {
+		p.LogLevel = o.LogLevel
+	}
+	if o.Chaos != nil {
+		p.Chaos = o.Chaos
+	}
+	if o.HeaderEcho != "" {
+		p.HeaderEcho = o.HeaderEcho
+	}
+	return p
+}
+
+// LoadProfile 按环境变量HWENV选定执行环境的配置，并设定为 ExecProfile
+func LoadProfile(opts ProfileOptions) (Profile, error) {
+	p, err := resolveProfile(os.Getenv(envKey), opts)
+	if err != nil {
+		return p, err
+	}
+	ExecProfile = p
+	return p, nil
+}
+
+// resolveProfile 选定env对应的配置。配置名不区分大小写（配置文件中的键名会被转为小写）
+func resolveProfile(env string, opts ProfileOptions) (Profile, error) {
+	profiles := builtinProfiles()
+	for name, p := range opts.Profiles {
+		// 同名的内置配置只覆盖配置文件中设定的项目
+		if builtin, ok := findProfile(profiles, name); ok {
+			delete(profiles, builtin.Name)
+			builtin.Name = ""
+			p = builtin.merge(p)
+		}
+		profiles[name] = p
+	}
+
+	if env == "" {
+		if opts.Default == "" {
+			return Profile{}, nil
+		}
+		p, ok := findProfile(profiles, opts.Default)
+		if !ok {
+			return Profile{}, fmt.Errorf("default profile %q not found, known profiles: %s", opts.Default, profileNames(profiles))
+		}
+		return p, nil
+	}
+	if p, ok := findProfile(profiles, env); ok {
+		return p, nil
+	}
+	if opts.Fallback == "" {
+		return Profile{}, fmt.Errorf("unknown %s %q, known profiles: %s", envKey, env, profileNames(profiles))
+	}
+	p, ok := findProfile(profiles, opts.Fallback)
+	if !ok {
+		return Profile{}, fmt.Errorf("fallback profile %q not found, known profiles: %s", opts.Fallback, profileNames(profiles))
+	}
+	return p, nil
+}
+
+// findProfile 不区分大小写地查找配置，找到时设定配置名
+func findProfile(profiles map[string]Profile, name string) (Profile, bool) {
+	for n, p := range profiles {
+		if strings.EqualFold(n, name) {
+			p.Name = n
+			return p, true
+		}
+	}
+	return Profile{}, false
+}
+
+// profileNames 排序后的配置名，用于错误信息
+func profileNames(profiles map[string]Profile) string {
+	names := make([]string, 0, len(profiles))
+	for n := range profiles {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
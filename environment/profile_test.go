@@ -0,0 +1,90 @@
+package environment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnit_resolveProfile(t *testing.T) {
+	assert := assert.New(t)
+
+	enabled, disabled := true, false
+	opts := ProfileOptions{
+		Profiles: map[string]Profile{
+			// 配置文件中的键名会被转为小写
+			"staging":    {LogLevel: "info", Chaos: &disabled, HeaderEcho: "redact"},
+			"production": {LogLevel: "warn"},
+		},
+	}
+
+	// 没有设定HWENV且没有default时不使用任何配置
+	p, err := resolveProfile("", opts)
+	assert.NoError(err)
+	assert.Equal(Profile{}, p)
+
+	p, err = resolveProfile("Staging", opts)
+	assert.NoError(err)
+	assert.Equal("staging", p.Name)
+	assert.Equal("info", p.LogLevel)
+	assert.False(*p.Chaos)
+
+	// 同名的内置配置只覆盖设定的项目，其他项目保持内置的值
+	p, err = resolveProfile("Production", opts)
+	assert.NoError(err)
+	assert.Equal(Profile{Name: "production", Production: &enabled, LogLevel: "warn"}, p)
+
+	p, err = resolveProfile("localhost", opts)
+	assert.NoError(err)
+	assert.Equal(Profile{Name: "Localhost", Localhost: &enabled}, p)
+
+	// 明确设定的false也覆盖内置的值
+	p, err = resolveProfile("production", ProfileOptions{Profiles: map[string]Profile{"production": {Production: &disabled}}})
+	assert.NoError(err)
+	assert.False(*p.Production)
+
+	// 未知的执行环境没有fallback时为错误
+	_, err = resolveProfile("qa", opts)
+	assert.ErrorContains(err, `unknown HWENV "qa"`)
+	assert.ErrorContains(err, "Develop, Localhost, production, staging")
+
+	opts.Fallback = "Develop"
+	p, err = resolveProfile("qa", opts)
+	assert.NoError(err)
+	assert.Equal(Profile{Name: "Develop"}, p)
+
+	opts.Default = "staging"
+	p, err = resolveProfile("", opts)
+	assert.NoError(err)
+	assert.Equal("staging", p.Name)
+
+	_, err = resolveProfile("", ProfileOptions{Default: "missing"})
+	assert.ErrorContains(err, `default profile "missing" not found`)
+	_, err = resolveProfile("qa", ProfileOptions{Fallback: "missing"})
+	assert.ErrorContains(err, `fallback profile "missing" not found`)
+}
+
+func TestUnit_loadProfile(t *testing.T) {
+	assert := assert.New(t)
+
+	saved := ExecProfile
+	defer func() { ExecProfile = saved }()
+
+	t.Setenv(envKey, "Production")
+	_, err := LoadProfile(ProfileOptions{})
+	assert.NoError(err)
+	assert.True(IsProduction())
+	assert.False(IsLocalhost())
+	assert.False(IsDevelopment())
+
+	t.Setenv(envKey, "develop")
+	_, err = LoadProfile(ProfileOptions{})
+	assert.NoError(err)
+	assert.True(IsDevelopment())
+
+	// 失败时保持原来的配置
+	t.Setenv(envKey, "qa")
+	_, err = LoadProfile(ProfileOptions{})
+	assert.Error(err)
+	assert.True(IsDevelopment())
+}
@@ -0,0 +1,35 @@
+package environment
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// ResourceAttributes OpenTelemetry的资源属性：服务名、版本、主机名、执行环境和k8s的Pod信息。
+// 指标和链路追踪共用，extra 中的同名属性优先，值为空的属性不输出
+func ResourceAttributes(service string, extra map[string]string) []attribute.KeyValue {
+	version := Version
+	if version == "" {
+		version = BuildInfo
+	}
+	attrs := map[attribute.Key]string{
+		semconv.ServiceNameKey:           service,
+		semconv.ServiceVersionKey:        version,
+		semconv.HostNameKey:              Hostname,
+		semconv.DeploymentEnvironmentKey: ExecENV,
+	}
+	for k, v := range Pod.ResourceAttributes() {
+		attrs[attribute.Key(k)] = v
+	}
+	for k, v := range extra {
+		attrs[attribute.Key(k)] = v
+	}
+
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for k, v := range attrs {
+		if v != "" {
+			kvs = append(kvs, k.String(v))
+		}
+	}
+	return kvs
+}
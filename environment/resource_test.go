@@ -0,0 +1,37 @@
+package environment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+func TestUnit_resourceAttributes(t *testing.T) {
+	assert := assert.New(t)
+
+	savedEnv, savedPod, savedVersion := ExecENV, Pod, Version
+	ExecENV, Version = "Develop", "v1.2.3"
+	Pod = PodMeta{Name: "httpserver-0", Namespace: "homework", Labels: map[string]string{"app": "httpserver"}}
+	defer func() { ExecENV, Pod, Version = savedEnv, savedPod, savedVersion }()
+
+	set := attribute.NewSet(ResourceAttributes("httpserver", map[string]string{
+		"team": "platform", string(semconv.ServiceNameKey): "api", string(semconv.HostNameKey): "",
+	})...)
+
+	for k, want := range map[attribute.Key]string{
+		semconv.ServiceNameKey:           "api",
+		semconv.ServiceVersionKey:        "v1.2.3",
+		semconv.DeploymentEnvironmentKey: "Develop",
+		semconv.K8SPodNameKey:            "httpserver-0",
+		semconv.K8SNamespaceNameKey:      "homework",
+		"k8s.pod.label.app":              "httpserver",
+		"team":                           "platform",
+	} {
+		v, _ := set.Value(k)
+		assert.Equal(want, v.AsString(), k)
+	}
+	// 值为空的属性不输出
+	assert.False(set.HasValue(semconv.HostNameKey))
+}
@@ -1,8 +1,12 @@
 package logger
 
 import (
+	"fmt"
+	"io"
 	"runtime"
 
+	"github.com/kabacloud/cloudnativehomework4-module10/environment"
+
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
@@ -10,107 +14,230 @@ import (
 type LoggerProvider struct {
 	level       string
 	servicename string
+	caller      bool           // 是否输出调用者的函数名和行号
+	log         zerolog.Logger // 写入所有输出目标的日志对象
+	closers     []io.Closer    // 退出时需要关闭的输出目标
+	sampler     *Sampler       // 按消息采样
+	redactor    *redactor      // 敏感信息脱敏
 }
 
 // InitLogger 初始化Log部品
 func NewLogger(level string, serviceName string) *LoggerProvider {
+	l, err := NewLoggerWithOptions(Options{Level: level, ServiceName: serviceName})
+	if err != nil {
+		panic(err)
+	}
+	return l
+}
+
+// NewLoggerWithOptions 根据配置初始化Log部品
+func NewLoggerWithOptions(opts Options) (*LoggerProvider, error) {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 
 	l := &LoggerProvider{}
-	l.level = level
-	logLevel, err := zerolog.ParseLevel(level)
+	l.level = opts.Level
+	logLevel, err := zerolog.ParseLevel(opts.Level)
 	if err != nil {
-		panic("log level NG")
+		return nil, fmt.Errorf("log level NG: %w", err)
 	}
 	zerolog.SetGlobalLevel(logLevel)
-	l.servicename = serviceName
+	l.servicename = opts.ServiceName
+	l.caller = opts.Caller
+	l.sampler, err = NewSampler(opts.Sampling)
+	if err != nil {
+		return nil, err
+	}
 
-	log.Info().Msg("Logger init success on " + l.servicename)
-	return l
+	l.redactor, err = newRedactor(opts.Redact)
+	if err != nil {
+		return nil, err
+	}
+	defaultRedactor.Store(l.redactor)
+
+	w, closers, err := newOutputs(opts)
+	if err != nil {
+		return nil, err
+	}
+	l.log = zerolog.New(redactWriter{r: l.redactor, w: w}).With().Fields(defaultFields(opts.Fields)).Logger()
+	l.closers = closers
+
+	l.log.Info().Timestamp().Msg("Logger init success on " + l.servicename)
+	return l, nil
+}
+
+// defaultFields Pod的元数据和配置的字段，配置优先
+func defaultFields(fields map[string]string) map[string]interface{} {
+	m := map[string]interface{}{}
+	for k, v := range environment.Pod.LogFields() {
+		m[k] = v
+	}
+	for k, v := range fields {
+		if v == "" {
+			delete(m, k)
+			continue
+		}
+		m[k] = v
+	}
+	return m
+}
+
+// Close 关闭日志文件、syslog连接等输出目标
+func (l *LoggerProvider) Close() error {
+	if l == nil {
+		return nil
+	}
+	var firstErr error
+	for _, c := range l.closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	l.closers = nil
+	return firstErr
 }
 
 // Info 输出普通日志
 func (l *LoggerProvider) Info(message string) {
+	if !l.sample(zerolog.InfoLevel, message) {
+		return
+	}
 	funcName, line := l.getFuncInfo()
-	l.addHeader(log.Info(), funcName, line).Msg(message)
+	l.addHeader(l.logger().Info(), funcName, line).Msg(message)
 }
 
 // InfoI 输出普通日志
 func (l *LoggerProvider) InfoI(message string, key string, i interface{}) {
+	if !l.sample(zerolog.InfoLevel, message) {
+		return
+	}
 	funcName, line := l.getFuncInfo()
-	l.addHeader(log.Info(), funcName, line).Interface(key, i).Msg(message)
+	l.addHeader(l.logger().Info(), funcName, line).Interface(key, l.redactObject(i)).Msg(message)
 }
 
 // Warn 输出警告日志
 func (l *LoggerProvider) Warn(message string) {
+	if !l.sample(zerolog.WarnLevel, message) {
+		return
+	}
 	funcName, line := l.getFuncInfo()
-	l.addHeader(log.Warn(), funcName, line).Timestamp().Msg(message)
+	l.addHeader(l.logger().Warn(), funcName, line).Msg(message)
 }
 
 // WarnI 输出警告日志
 func (l *LoggerProvider) WarnI(message string, key string, i interface{}) {
+	if !l.sample(zerolog.WarnLevel, message) {
+		return
+	}
 	funcName, line := l.getFuncInfo()
-	l.addHeader(log.Warn(), funcName, line).Interface(key, i).Msg(message)
+	l.addHeader(l.logger().Warn(), funcName, line).Interface(key, l.redactObject(i)).Msg(message)
 }
 
 // Debug 输出调试日志
 func (l *LoggerProvider) Debug(message string) {
+	if !l.sample(zerolog.DebugLevel, message) {
+		return
+	}
 	funcName, line := l.getFuncInfo()
-	l.addHeader(log.Debug(), funcName, line).Msg(message)
+	l.addHeader(l.logger().Debug(), funcName, line).Msg(message)
 }
 
 // DebugI 输出调试日志，含任意对象
 func (l *LoggerProvider) DebugI(message string, key string, i interface{}) {
+	if !l.sample(zerolog.DebugLevel, message) {
+		return
+	}
 	funcName, line := l.getFuncInfo()
-	l.addHeader(log.Debug(), funcName, line).Interface(key, i).Msg(message)
+	l.addHeader(l.logger().Debug(), funcName, line).Interface(key, l.redactObject(i)).Msg(message)
 }
 
 // Error 输入错误日志
 func (l *LoggerProvider) Error(message string, err error) {
+	if !l.sample(zerolog.ErrorLevel, message) {
+		return
+	}
 	funcName, line := l.getFuncInfo()
-	l.addHeader(log.Err(err), funcName, line).Stack().Msg(message)
+	l.addHeader(l.logger().Err(err), funcName, line).Stack().Msg(message)
 }
 
 // ErrorI 输入错误日志
 func (l *LoggerProvider) ErrorI(message string, err error, key string, i interface{}) {
+	if !l.sample(zerolog.ErrorLevel, message) {
+		return
+	}
 	funcName, line := l.getFuncInfo()
-	l.addHeader(log.Err(err), funcName, line).Stack().Interface(key, i).Msg(message)
+	l.addHeader(l.logger().Err(err), funcName, line).Stack().Interface(key, l.redactObject(i)).Msg(message)
 }
 
 // Fatal 严重问题（os.Exit(1)）
 func (l *LoggerProvider) Fatal(message string) {
 	funcName, line := l.getFuncInfo()
-	l.addHeader(log.Fatal(), funcName, line).Msg(message)
+	l.addHeader(l.logger().Fatal(), funcName, line).Msg(message)
 }
 
 // FatalI 严重问题（os.Exit(1)）
 func (l *LoggerProvider) FatalI(message string, key string, i interface{}) {
 	funcName, line := l.getFuncInfo()
-	l.addHeader(log.Fatal(), funcName, line).Interface(key, i).Msg(message)
+	l.addHeader(l.logger().Fatal(), funcName, line).Interface(key, l.redactObject(i)).Msg(message)
 }
 
 // Panic 恐慌问题（os.Exit(1)）
 func (l *LoggerProvider) Panic(message string) {
 	funcName, line := l.getFuncInfo()
-	l.addHeader(log.Panic(), funcName, line).Msg(message)
+	l.addHeader(l.logger().Panic(), funcName, line).Msg(message)
 }
 
 // PanicI 恐慌问题（os.Exit(1)）
 func (l *LoggerProvider) PanicI(message string, key string, i interface{}) {
 	funcName, line := l.getFuncInfo()
-	l.addHeader(log.Panic(), funcName, line).Interface(key, i).Msg(message)
+	l.addHeader(l.logger().Panic(), funcName, line).Interface(key, l.redactObject(i)).Msg(message)
 }
 
 func (l *LoggerProvider) addHeader(log *zerolog.Event, funcName string, line int) *zerolog.Event {
-	// 暂时先不输出文件名和行号
-	// if line > 0 {
-	// 	return log.Timestamp().Str("func", funcName).Int("line", line)
-	// }
+	if l != nil && l.caller && line > 0 {
+		return log.Timestamp().Str("func", funcName).Int("line", line)
+	}
 	return log.Timestamp()
 }
 
+// sample 判断这条日志是否输出，未达到输出级别的日志不计入采样
+func (l *LoggerProvider) sample(level zerolog.Level, message string) bool {
+	if l == nil || level < zerolog.GlobalLevel() {
+		return true
+	}
+	return l.sampler.Allow(message)
+}
+
+// Suppressed 各消息因采样被丢弃的累计条数
+func (l *LoggerProvider) Suppressed() map[string]uint64 {
+	if l == nil {
+		return map[string]uint64{}
+	}
+	return l.sampler.Suppressed()
+}
+
+// redactObject 把对象中带 `log:"redact"` 标签的字段替换掉
+func (l *LoggerProvider) redactObject(i interface{}) interface{} {
+	if l == nil {
+		return defaultRedactor.Load().redactObject(i)
+	}
+	return l.redactor.redactObject(i)
+}
+
+// logger 返回写入日志用的对象，未初始化时使用zerolog的全局日志对象
+func (l *LoggerProvider) logger() *zerolog.Logger {
+	if l == nil {
+		return &log.Logger
+	}
+	return &l.log
+}
+
 func (l *LoggerProvider) getFuncInfo() (string, int) {
-	if pc, _, line, ok := runtime.Caller(2); ok {
+	return callerInfo(2)
+}
+
+// callerInfo 取得调用栈上第skip层（不含本函数）的函数名和行号
+func callerInfo(skip int) (string, int) {
+	if pc, _, line, ok := runtime.Caller(skip + 1); ok {
 		funcName := runtime.FuncForPC(pc).Name()
 		return funcName, line
 	}
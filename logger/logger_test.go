@@ -0,0 +1,78 @@
+package logger
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnit_multipleOutputs(t *testing.T) {
+	assert := assert.New(t)
+
+	// 标准输出替换为管道
+	r, w, err := os.Pipe()
+	assert.NoError(err)
+	saved := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = saved }()
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	l, err := NewLoggerWithOptions(Options{
+		Level:       "info",
+		ServiceName: "test",
+		Caller:      true,
+		Outputs: []OutputOptions{
+			{Type: OutputFile, Path: path},
+			{Type: OutputStdout, Format: FormatConsole},
+		},
+	})
+	assert.NoError(err)
+	os.Stdout = saved
+
+	l.InfoI("multiple outputs", "user", "alice")
+	_, _, line, _ := runtime.Caller(0)
+	line-- // 上一行的行号
+	l.Debug("below level")
+	assert.NoError(l.Close())
+	assert.NoError(w.Close())
+
+	// 文件为每行一个JSON对象，带有调用者的函数名和行号
+	f, err := os.Open(path)
+	assert.NoError(err)
+	defer f.Close()
+	var entry map[string]interface{}
+	for s := bufio.NewScanner(f); s.Scan(); {
+		var e map[string]interface{}
+		assert.NoError(json.Unmarshal(s.Bytes(), &e))
+		if e["message"] == "multiple outputs" {
+			entry = e
+		}
+		assert.NotEqual("below level", e["message"])
+	}
+	if assert.NotNil(entry) {
+		assert.Equal("info", entry["level"])
+		assert.Equal("alice", entry["user"])
+		assert.True(strings.HasSuffix(entry["func"].(string), ".TestUnit_multipleOutputs"), entry["func"])
+		assert.Equal(float64(line), entry["line"])
+	}
+
+	// 控制台为易读的格式，同一条日志同样带有调用者
+	b, err := io.ReadAll(r)
+	assert.NoError(err)
+	console := string(b)
+	for _, ln := range strings.Split(strings.TrimSpace(console), "\n") {
+		assert.False(strings.HasPrefix(ln, "{"), ln)
+	}
+	assert.Contains(console, "multiple outputs")
+	assert.Contains(console, "TestUnit_multipleOutputs")
+	assert.Contains(console, strconv.Itoa(line))
+	assert.NotContains(console, "below level")
+}
@@ -0,0 +1,124 @@
+package logger
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/rs/zerolog"
+)
+
+// logrSink 把go-logr的日志（client-go、controller-runtime等）写入LoggerProvider
+type logrSink struct {
+	l      *LoggerProvider
+	name   string
+	values map[string]interface{} // WithValues 追加的键值
+	depth  int                    // 调用栈需要跳过的层数
+}
+
+// Logr 返回以LoggerProvider为输出的logr.Logger
+func (l *LoggerProvider) Logr() logr.Logger {
+	return logr.New(l.LogSink())
+}
+
+// LogSink 返回以LoggerProvider为输出的logr.LogSink
+func (l *LoggerProvider) LogSink() logr.LogSink {
+	return &logrSink{l: l, values: map[string]interface{}{}}
+}
+
+func (s *logrSink) Init(info logr.RuntimeInfo) {
+	s.depth = info.CallDepth
+}
+
+// Enabled logr的V(0)对应info，V(1)对应debug，V(2)以上对应trace
+func (s *logrSink) Enabled(level int) bool {
+	return logrLevel(level) >= zerolog.GlobalLevel()
+}
+
+func (s *logrSink) Info(level int, msg string, keysAndValues ...interface{}) {
+	zl := logrLevel(level)
+	if !s.l.sample(zl, msg) {
+		return
+	}
+	s.write(s.l.logger().WithLevel(zl), msg, keysAndValues)
+}
+
+func (s *logrSink) Error(err error, msg string, keysAndValues ...interface{}) {
+	if !s.l.sample(zerolog.ErrorLevel, msg) {
+		return
+	}
+	s.write(s.l.logger().Err(err), msg, keysAndValues)
+}
+
+func (s *logrSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	s2 := *s
+	s2.values = make(map[string]interface{}, len(s.values)+len(keysAndValues)/2)
+	for k, v := range s.values {
+		s2.values[k] = v
+	}
+	s.merge(s2.values, keysAndValues)
+	return &s2
+}
+
+func (s *logrSink) WithName(name string) logr.LogSink {
+	s2 := *s
+	if s.name != "" {
+		s2.name = s.name + "/" + name
+	} else {
+		s2.name = name
+	}
+	return &s2
+}
+
+// WithCallDepth 实现 logr.CallDepthLogSink，用于输出正确的调用者
+func (s *logrSink) WithCallDepth(depth int) logr.LogSink {
+	s2 := *s
+	s2.depth += depth
+	return &s2
+}
+
+func (s *logrSink) write(e *zerolog.Event, msg string, keysAndValues []interface{}) {
+	fields := make(map[string]interface{}, len(s.values)+len(keysAndValues)/2)
+	for k, v := range s.values {
+		fields[k] = v
+	}
+	s.merge(fields, keysAndValues)
+
+	e = e.Timestamp()
+	if s.l != nil && s.l.caller {
+		// 本方法和LogSink的Info/Error各占一层，logr.Logger的方法已包含在depth中
+		if funcName, line := callerInfo(s.depth + 2); line > 0 {
+			e = e.Str("func", funcName).Int("line", line)
+		}
+	}
+	if s.name != "" {
+		e = e.Str("logger", s.name)
+	}
+	e.Fields(fields).Msg(msg)
+}
+
+// merge 把键值对列表放入map，键不是字符串时转为字符串
+func (s *logrSink) merge(fields map[string]interface{}, keysAndValues []interface{}) {
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key := fmt.Sprint(keysAndValues[i])
+		var v interface{} = "(MISSING)"
+		if i+1 < len(keysAndValues) {
+			v = keysAndValues[i+1]
+		}
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		fields[key] = s.l.redactObject(v)
+	}
+}
+
+// logrLevel 把logr的V级别转换为zerolog的级别
+func logrLevel(level int) zerolog.Level {
+	switch {
+	case level <= 0:
+		return zerolog.InfoLevel
+	case level == 1:
+		return zerolog.DebugLevel
+	default:
+		return zerolog.TraceLevel
+	}
+}
@@ -0,0 +1,367 @@
+package logger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/environment"
+)
+
+// Loki推送的默认设定
+const (
+	lokiPushPath          = "/loki/api/v1/push"
+	lokiDefaultBatchSize  = 100
+	lokiDefaultBatchWait  = time.Second
+	lokiDefaultBufferSize = 10000
+	lokiDefaultMaxRetries = 3
+	lokiDefaultTimeout    = 5 * time.Second
+	lokiDefaultCloseWait  = 5 * time.Second
+	lokiMinBackoff        = 100 * time.Millisecond
+	lokiMaxBackoff        = 5 * time.Second
+)
+
+// lokiEntry 待推送的一条日志
+type lokiEntry struct {
+	ts     time.Time
+	line   string
+	labels map[string]string
+}
+
+// lokiStream 同一组标签的日志，对应Loki推送API中的stream
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// lokiWriter 把日志批量推送到Loki的输出目标。
+// Write只把日志放入缓冲区，由后台协程负责推送，缓冲区满时丢弃日志，不会阻塞请求处理。
+type lokiWriter struct {
+	url         string
+	tenant      string
+	labels      map[string]string // 固定标签
+	labelFields map[string]string // 日志字段名 -> 标签名
+	batchSize   int
+	batchWait   time.Duration
+	maxRetries  int
+	closeWait   time.Duration
+	client      *http.Client
+
+	entries   chan lokiEntry
+	quit      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	ctx       context.Context    // 推送请求的上下文，关闭超时时取消
+	cancel    context.CancelFunc // 取消推送中的请求
+
+	dropped uint64 // 因缓冲区满或关闭超时而丢弃的日志条数
+	failed  uint64 // 重试后仍推送失败的日志条数
+}
+
+// newLoki 生成Loki输出目标并启动后台推送协程
+func newLoki(o OutputOptions, serviceName string) (*lokiWriter, error) {
+	if o.URL == "" {
+		return nil, fmt.Errorf("log output loki: url is required")
+	}
+
+	w := &lokiWriter{
+		url:         strings.TrimSuffix(o.URL, "/") + lokiPushPath,
+		tenant:      o.Tenant,
+		labels:      map[string]string{},
+		labelFields: o.LabelFields,
+		batchSize:   o.BatchSize,
+		batchWait:   o.BatchWait,
+		maxRetries:  o.MaxRetries,
+		closeWait:   o.CloseWait,
+		client:      &http.Client{Timeout: o.Timeout},
+		quit:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	if w.batchSize <= 0 {
+		w.batchSize = lokiDefaultBatchSize
+	}
+	if w.batchWait <= 0 {
+		w.batchWait = lokiDefaultBatchWait
+	}
+	if w.maxRetries < 0 {
+		w.maxRetries = 0
+	} else if w.maxRetries == 0 {
+		w.maxRetries = lokiDefaultMaxRetries
+	}
+	if w.client.Timeout <= 0 {
+		w.client.Timeout = lokiDefaultTimeout
+	}
+	if w.closeWait <= 0 {
+		w.closeWait = lokiDefaultCloseWait
+	}
+	if len(w.labelFields) == 0 {
+		w.labelFields = map[string]string{"level": "level"}
+	}
+	bufferSize := o.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = lokiDefaultBufferSize
+	}
+	w.entries = make(chan lokiEntry, bufferSize)
+
+	// 默认用服务名、执行环境和主机名作为固定标签，可被配置覆盖
+	for k, v := range map[string]string{
+		"service": serviceName,
+		"env":     environment.ExecENV,
+		"host":    environment.Hostname,
+	} {
+		if v != "" {
+			w.labels[k] = v
+		}
+	}
+	for k, v := range o.Labels {
+		if v == "" {
+			delete(w.labels, k)
+			continue
+		}
+		w.labels[k] = v
+	}
+
+	go w.run()
+	return w, nil
+}
+
+// Write 把一条日志放入缓冲区，缓冲区满时丢弃
+func (w *lokiWriter) Write(p []byte) (int, error) {
+	e := lokiEntry{
+		ts:     time.Now(),
+		line:   strings.TrimRight(string(p), "\n"),
+		labels: w.labelsOf(p),
+	}
+	select {
+	case w.entries <- e:
+	default:
+		atomic.AddUint64(&w.dropped, 1)
+	}
+	return len(p), nil
+}
+
+// Close 推送缓冲区中剩余的日志后停止后台协程。关闭后不再重试，
+// 超过closeWait仍未推送完时取消推送中的请求，剩余的日志计入丢弃的条数
+func (w *lokiWriter) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.quit)
+	})
+	timer := time.NewTimer(w.closeWait)
+	defer timer.Stop()
+	select {
+	case <-w.done:
+		return nil
+	case <-timer.C:
+		w.cancel()
+		<-w.done
+		return fmt.Errorf("loki: close timed out after %s, %d entries dropped in total", w.closeWait, w.Dropped())
+	}
+}
+
+// Dropped 因缓冲区满或关闭超时而丢弃的日志条数
+func (w *lokiWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+// Failed 重试后仍推送失败的日志条数
+func (w *lokiWriter) Failed() uint64 {
+	return atomic.LoadUint64(&w.failed)
+}
+
+// labelsOf 合并固定标签和从日志字段中取出的标签
+func (w *lokiWriter) labelsOf(p []byte) map[string]string {
+	labels := make(map[string]string, len(w.labels)+len(w.labelFields))
+	for k, v := range w.labels {
+		labels[k] = v
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(p, &fields); err != nil {
+		return labels
+	}
+	for field, label := range w.labelFields {
+		if v, ok := fields[field]; ok {
+			if s := fmt.Sprint(v); s != "" {
+				labels[label] = s
+			}
+		}
+	}
+	return labels
+}
+
+// run 后台推送协程，条数达到batchSize或等待超过batchWait时推送一次
+func (w *lokiWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.batchWait)
+	defer ticker.Stop()
+
+	batch := make([]lokiEntry, 0, w.batchSize)
+	flush := func() {
+		if len(batch) > 0 {
+			w.push(batch)
+			batch = make([]lokiEntry, 0, w.batchSize)
+		}
+	}
+
+	for {
+		select {
+		case e := <-w.entries:
+			batch = append(batch, e)
+			if len(batch) >= w.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-w.quit:
+			// 推送缓冲区中剩余的日志，关闭超时时剩余的日志计入丢弃的条数
+			for {
+				if w.ctx.Err() != nil {
+					atomic.AddUint64(&w.dropped, uint64(len(batch)+len(w.entries)))
+					return
+				}
+				select {
+				case e := <-w.entries:
+					batch = append(batch, e)
+					if len(batch) >= w.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// push 推送一批日志，网络错误、429和5xx时按指数退避重试，开始关闭后不再重试
+func (w *lokiWriter) push(batch []lokiEntry) {
+	body, err := w.encode(batch)
+	if err != nil {
+		atomic.AddUint64(&w.failed, uint64(len(batch)))
+		return
+	}
+
+	backoff := lokiMinBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := w.send(body)
+		if err == nil {
+			return
+		}
+		if w.ctx.Err() != nil {
+			atomic.AddUint64(&w.dropped, uint64(len(batch)))
+			return
+		}
+		if !retry || attempt >= w.maxRetries || w.closing() {
+			atomic.AddUint64(&w.failed, uint64(len(batch)))
+			return
+		}
+		select {
+		case <-time.After(backoff):
+		case <-w.quit:
+		}
+		backoff *= 2
+		if backoff > lokiMaxBackoff {
+			backoff = lokiMaxBackoff
+		}
+	}
+}
+
+// closing 是否已开始关闭
+func (w *lokiWriter) closing() bool {
+	select {
+	case <-w.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+// send 发送一次推送请求，返回失败时是否值得重试
+func (w *lokiWriter) send(body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(w.ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	if w.tenant != "" {
+		req.Header.Set("X-Scope-OrgID", w.tenant)
+	}
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	_ = res.Body.Close()
+
+	if res.StatusCode/100 == 2 {
+		return false, nil
+	}
+	retry := res.StatusCode == http.StatusTooManyRequests || res.StatusCode/100 == 5
+	return retry, fmt.Errorf("loki push: %s", res.Status)
+}
+
+// encode 按标签把日志分组成stream，生成gzip压缩后的推送请求体
+func (w *lokiWriter) encode(batch []lokiEntry) ([]byte, error) {
+	streams := map[string]*lokiStream{}
+	keys := make([]string, 0)
+	for _, e := range batch {
+		key := labelsKey(e.labels)
+		s, ok := streams[key]
+		if !ok {
+			s = &lokiStream{Stream: e.labels}
+			streams[key] = s
+			keys = append(keys, key)
+		}
+		s.Values = append(s.Values, [2]string{strconv.FormatInt(e.ts.UnixNano(), 10), e.line})
+	}
+
+	req := struct {
+		Streams []*lokiStream `json:"streams"`
+	}{}
+	for _, key := range keys {
+		req.Streams = append(req.Streams, streams[key])
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(gz).Encode(req); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// labelsKey 把标签排序后拼接成用于分组的字符串
+func labelsKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, k := range names {
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[k]))
+		b.WriteByte(',')
+	}
+	return b.String()
+}
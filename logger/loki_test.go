@@ -0,0 +1,193 @@
+package logger
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// lokiStub 模拟Loki推送API，记录收到的stream
+type lokiStub struct {
+	mu       sync.Mutex
+	streams  []lokiStream
+	requests int
+	status   []int // 按请求顺序返回的状态码，用完后返回204
+}
+
+func (s *lokiStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+	if len(s.status) > 0 {
+		status := s.status[0]
+		s.status = s.status[1:]
+		if status != http.StatusNoContent {
+			w.WriteHeader(status)
+			return
+		}
+	}
+
+	gz, err := gzip.NewReader(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Streams []lokiStream `json:"streams"`
+	}
+	if err := json.NewDecoder(gz).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.streams = append(s.streams, req.Streams...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *lokiStub) lines() map[string][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lines := map[string][]string{}
+	for _, st := range s.streams {
+		for _, v := range st.Values {
+			lines[st.Stream["level"]] = append(lines[st.Stream["level"]], v[1])
+		}
+	}
+	return lines
+}
+
+func TestUnit_lokiPush(t *testing.T) {
+	assert := assert.New(t)
+
+	stub := &lokiStub{}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	w, err := newLoki(OutputOptions{
+		URL:       srv.URL,
+		Labels:    map[string]string{"app": "httpserver", "host": ""},
+		BatchWait: 10 * time.Millisecond,
+	}, "test")
+	assert.NoError(err)
+
+	_, _ = w.Write([]byte(`{"level":"info","message":"hello"}` + "\n"))
+	_, _ = w.Write([]byte(`{"level":"warn","message":"careful"}` + "\n"))
+	_, _ = w.Write([]byte(`{"level":"info","message":"world"}` + "\n"))
+	assert.NoError(w.Close())
+
+	lines := stub.lines()
+	assert.Equal([]string{`{"level":"info","message":"hello"}`, `{"level":"info","message":"world"}`}, lines["info"])
+	assert.Equal([]string{`{"level":"warn","message":"careful"}`}, lines["warn"])
+
+	for _, st := range stub.streams {
+		assert.Equal("httpserver", st.Stream["app"])
+		assert.Equal("test", st.Stream["service"])
+		_, ok := st.Stream["host"]
+		assert.False(ok, "空值的标签应被删除")
+	}
+}
+
+func TestUnit_lokiRetry(t *testing.T) {
+	assert := assert.New(t)
+
+	stub := &lokiStub{status: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	w, err := newLoki(OutputOptions{URL: srv.URL, BatchWait: 10 * time.Millisecond}, "test")
+	assert.NoError(err)
+
+	_, _ = w.Write([]byte(`{"level":"error","message":"boom"}`))
+	// 关闭后不再重试，所以等推送成功后再关闭
+	assert.Eventually(func() bool { return len(stub.lines()["error"]) == 1 }, 2*time.Second, 10*time.Millisecond)
+	assert.NoError(w.Close())
+
+	assert.Equal(3, stub.requests)
+	assert.Equal([]string{`{"level":"error","message":"boom"}`}, stub.lines()["error"])
+	assert.Zero(w.Failed())
+}
+
+func TestUnit_lokiNeverBlocks(t *testing.T) {
+	assert := assert.New(t)
+
+	// Loki无响应时，写入也要立即返回，超出缓冲区的日志被丢弃
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+
+	w, err := newLoki(OutputOptions{
+		URL:        srv.URL,
+		BatchSize:  1,
+		BufferSize: 2,
+		MaxRetries: -1,
+	}, "test")
+	assert.NoError(err)
+
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		_, _ = w.Write([]byte(`{"level":"info","message":"hello"}`))
+	}
+	assert.Less(int64(time.Since(start)), int64(time.Second))
+	assert.NotZero(w.Dropped())
+
+	close(release)
+	assert.NoError(w.Close())
+}
+
+func TestUnit_lokiCloseTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	// Loki无响应时，关闭也要在closeWait后返回，剩余的日志计入丢弃的条数
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	w, err := newLoki(OutputOptions{
+		URL:       srv.URL,
+		BatchSize: 2,
+		Timeout:   time.Minute,
+		CloseWait: 100 * time.Millisecond,
+	}, "test")
+	assert.NoError(err)
+
+	for i := 0; i < 5; i++ {
+		_, _ = w.Write([]byte(`{"level":"info","message":"hello"}`))
+	}
+	start := time.Now()
+	assert.Error(w.Close())
+	assert.Less(int64(time.Since(start)), int64(time.Second))
+	assert.Equal(uint64(5), w.Dropped()+w.Failed())
+	assert.NotZero(w.Dropped())
+}
+
+func TestUnit_lokiNoRetryOnClose(t *testing.T) {
+	assert := assert.New(t)
+
+	// 关闭时推送失败的日志不再按退避重试
+	stub := &lokiStub{status: []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable}}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	w, err := newLoki(OutputOptions{URL: srv.URL, BatchWait: time.Hour}, "test")
+	assert.NoError(err)
+
+	_, _ = w.Write([]byte(`{"level":"error","message":"boom"}`))
+	assert.NoError(w.Close())
+	assert.Equal(1, stub.requests)
+	assert.Equal(uint64(1), w.Failed())
+}
@@ -0,0 +1,62 @@
+package logger
+
+import "time"
+
+// 日志输出目标的种类
+const (
+	OutputStdout = "stdout" // 标准输出
+	OutputStderr = "stderr" // 标准错误输出
+	OutputFile   = "file"   // 按大小和时间滚动的日志文件
+	OutputSyslog = "syslog" // 系统日志
+	OutputLoki   = "loki"   // 直接推送到Loki
+)
+
+// 控制台输出的格式
+const (
+	FormatJSON    = "json"    // 每行一个JSON对象，便于日志收集
+	FormatConsole = "console" // 带颜色的易读格式，便于本机调试
+)
+
+// Options 日志部品的配置
+type Options struct {
+	Level       string          `mapstructure:"level"`    // 日志级别
+	ServiceName string          `mapstructure:"service"`  // 服务名
+	Caller      bool            `mapstructure:"caller"`   // 是否输出调用者的函数名和行号
+	Outputs     []OutputOptions `mapstructure:"outputs"`  // 输出目标，可同时输出到多处。未设定时输出到标准错误输出
+	Sampling    SamplingOptions `mapstructure:"sampling"` // 按消息采样，用于频繁调用的日志（如探针）
+	Redact      RedactOptions   `mapstructure:"redact"`   // 敏感信息脱敏，作用于所有输出目标
+	// 附加到所有日志的字段。在k8s中执行时默认附加 pod、namespace 和 node，值为空时删除该字段
+	Fields map[string]string `mapstructure:"fields"`
+}
+
+// OutputOptions 单个输出目标的配置
+type OutputOptions struct {
+	Type string `mapstructure:"type"` // 输出目标的种类：stdout/stderr/file/syslog
+
+	// stdout/stderr
+	Format string `mapstructure:"format"` // 输出格式：json/console。未设定时单机环境为console，其他环境为json
+
+	// file
+	Path       string `mapstructure:"path"`       // 日志文件路径
+	MaxSize    int    `mapstructure:"maxsize"`    // 单个日志文件的最大尺寸（MB），超过后滚动
+	MaxAge     int    `mapstructure:"maxage"`     // 滚动后的旧文件最多保留的天数
+	MaxBackups int    `mapstructure:"maxbackups"` // 滚动后的旧文件最多保留的个数
+	Compress   bool   `mapstructure:"compress"`   // 是否用gzip压缩滚动后的旧文件
+
+	// syslog
+	Network string `mapstructure:"network"` // 连接方式：udp/tcp/unix，为空时连接本机的syslog
+	Address string `mapstructure:"address"` // syslog服务的地址
+	Tag     string `mapstructure:"tag"`     // syslog的tag，为空时使用服务名
+
+	// loki
+	URL         string            `mapstructure:"url"`         // Loki的地址，如 http://loki:3100
+	Tenant      string            `mapstructure:"tenant"`      // 多租户时的租户ID（X-Scope-OrgID）
+	Labels      map[string]string `mapstructure:"labels"`      // 固定标签，默认有service/env/host，值为空时删除该标签
+	LabelFields map[string]string `mapstructure:"labelfields"` // 作为标签的日志字段（字段名: 标签名），默认为 level: level
+	BatchSize   int               `mapstructure:"batchsize"`   // 一次推送的最大条数
+	BatchWait   time.Duration     `mapstructure:"batchwait"`   // 推送的最长等待时间
+	BufferSize  int               `mapstructure:"buffersize"`  // 等待推送的最大条数，超过后丢弃新日志
+	MaxRetries  int               `mapstructure:"maxretries"`  // 推送失败时的最大重试次数，负数时不重试
+	Timeout     time.Duration     `mapstructure:"timeout"`     // 单次推送的超时时间
+	CloseWait   time.Duration     `mapstructure:"closewait"`   // 退出时等待推送剩余日志的最长时间，超过后丢弃
+}
@@ -0,0 +1,86 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/environment"
+	"github.com/rs/zerolog"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// newOutputs 根据配置生成所有输出目标，返回合并后的输出和需要在退出时关闭的对象
+func newOutputs(opts Options) (zerolog.LevelWriter, []io.Closer, error) {
+	outputs := opts.Outputs
+	if len(outputs) == 0 {
+		outputs = []OutputOptions{{Type: OutputStderr}}
+	}
+
+	writers := make([]io.Writer, 0, len(outputs))
+	closers := make([]io.Closer, 0, len(outputs))
+	for _, o := range outputs {
+		w, c, err := newOutput(o, opts.ServiceName)
+		if err != nil {
+			// 已打开的输出目标要关闭掉
+			for _, c := range closers {
+				_ = c.Close()
+			}
+			return nil, nil, err
+		}
+		writers = append(writers, w)
+		if c != nil {
+			closers = append(closers, c)
+		}
+	}
+
+	return zerolog.MultiLevelWriter(writers...), closers, nil
+}
+
+// newOutput 生成单个输出目标。标准输出和标准错误输出不需要关闭，返回的io.Closer为nil
+func newOutput(o OutputOptions, serviceName string) (io.Writer, io.Closer, error) {
+	switch o.Type {
+	case OutputStdout:
+		return newConsole(os.Stdout, o.Format), nil, nil
+	case OutputStderr, "":
+		return newConsole(os.Stderr, o.Format), nil, nil
+	case OutputFile:
+		if o.Path == "" {
+			return nil, nil, fmt.Errorf("log output file: path is required")
+		}
+		f := &lumberjack.Logger{
+			Filename:   o.Path,
+			MaxSize:    o.MaxSize,
+			MaxAge:     o.MaxAge,
+			MaxBackups: o.MaxBackups,
+			Compress:   o.Compress,
+			LocalTime:  true,
+		}
+		return f, f, nil
+	case OutputSyslog:
+		tag := o.Tag
+		if tag == "" {
+			tag = serviceName
+		}
+		return newSyslog(o.Network, o.Address, tag)
+	case OutputLoki:
+		w, err := newLoki(o, serviceName)
+		if err != nil {
+			return nil, nil, err
+		}
+		return w, w, nil
+	default:
+		return nil, nil, fmt.Errorf("log output %q not supported", o.Type)
+	}
+}
+
+// newConsole 生成控制台输出，单机环境下默认使用带颜色的易读格式
+func newConsole(out *os.File, format string) io.Writer {
+	if format == "" && environment.IsLocalhost() {
+		format = FormatConsole
+	}
+	if format == FormatConsole {
+		return zerolog.ConsoleWriter{Out: out, TimeFormat: "2006-01-02 15:04:05.000000"}
+	}
+	return out
+}
@@ -0,0 +1,386 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+)
+
+const defaultMask = "[REDACTED]"
+
+// 默认脱敏的字段名（部分匹配，忽略大小写）
+var defaultRedactKeys = []string{
+	"passw(or)?d", "secret", "token", "authorization", "cookie", "api[-_]?key", "credential", "private[-_]?key",
+}
+
+// 默认脱敏的值
+var defaultRedactValues = []string{
+	`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`, // JWT
+	`(?i)bearer\s+[A-Za-z0-9._~+/=-]+`,                  // Bearer token
+}
+
+// 信用卡号，匹配后还要通过Luhn校验，避免误伤普通数字
+var cardNumber = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+
+// RedactOptions 敏感信息脱敏的配置，设定的内容追加在默认规则之后
+type RedactOptions struct {
+	Keys   []string `mapstructure:"keys"`   // 需要脱敏的字段名（正则，部分匹配，忽略大小写）
+	Values []string `mapstructure:"values"` // 需要脱敏的值（正则）
+	Mask   string   `mapstructure:"mask"`   // 替换敏感信息的字符串，默认为 [REDACTED]
+}
+
+// redactor 对日志中的敏感信息脱敏。
+// 字段名和值的规则作用于写入输出目标前的每一行日志，结构体标签 `log:"redact"` 作用于 InfoI 等方法传入的对象。
+type redactor struct {
+	mask       string
+	jsonMask   string           // 替换JSON中的数字用，JSON字符串形式的mask
+	quotedMask string           // 替换JSON值用，已转义为JSON字符串，并转义了正则替换中的$
+	key        *regexp.Regexp   // 匹配字段名
+	field      *regexp.Regexp   // 匹配JSON中的 "字段名":值
+	values     []*regexp.Regexp // 匹配值
+}
+
+// 不经过Log部品的脱敏使用的规则，未初始化Log部品时为默认规则，初始化时替换为Log部品的规则
+var defaultRedactor atomic.Pointer[redactor]
+
+func init() {
+	r, _ := newRedactor(RedactOptions{})
+	defaultRedactor.Store(r)
+}
+
+// newRedactor 编译脱敏规则
+func newRedactor(opts RedactOptions) (*redactor, error) {
+	r := &redactor{mask: opts.Mask}
+	if r.mask == "" {
+		r.mask = defaultMask
+	}
+	quoted, _ := json.Marshal(r.mask)
+	r.jsonMask = string(quoted)
+	r.quotedMask = strings.ReplaceAll(r.jsonMask, "$", "$$")
+
+	keys := append(append([]string{}, defaultRedactKeys...), opts.Keys...)
+	for _, k := range keys {
+		if _, err := regexp.Compile(k); err != nil {
+			return nil, fmt.Errorf("redact key %q: %w", k, err)
+		}
+	}
+	pattern := "(?:" + strings.Join(keys, "|") + ")"
+	r.key = regexp.MustCompile(`(?i)` + pattern)
+	// 只替换字符串、数字和布尔值，对象和数组的内部字段会单独匹配
+	r.field = regexp.MustCompile(`("(?i:[^"]*` + pattern + `[^"]*)"\s*:\s*)("(?:[^"\\]|\\.)*"|-?[0-9][0-9.eE+-]*|true|false)`)
+
+	for _, v := range append(append([]string{}, defaultRedactValues...), opts.Values...) {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return nil, fmt.Errorf("redact value %q: %w", v, err)
+		}
+		r.values = append(r.values, re)
+	}
+	return r, nil
+}
+
+// Redact 按默认规则对一个字段脱敏，用于不经过Log部品输出的日志（如请求头）
+func Redact(key string, value string) string {
+	return defaultRedactor.Load().redact(key, value)
+}
+
+// RedactQuery 按默认规则对查询参数脱敏，参数名作为字段名
+func RedactQuery(query url.Values) url.Values {
+	r := defaultRedactor.Load()
+	redacted := make(url.Values, len(query))
+	for k, vs := range query {
+		values := make([]string, len(vs))
+		for i, v := range vs {
+			values[i] = r.redact(k, v)
+		}
+		redacted[k] = values
+	}
+	return redacted
+}
+
+// RedactURL 按默认规则对URL的查询参数脱敏，参数的顺序和没有替换的参数的编码保持不变
+func RedactURL(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.String()
+	}
+	r := defaultRedactor.Load()
+	params := strings.Split(u.RawQuery, "&")
+	for i, param := range params {
+		rawKey, rawValue, ok := strings.Cut(param, "=")
+		key, err := url.QueryUnescape(rawKey)
+		if err != nil {
+			key = rawKey
+		}
+		value, err := url.QueryUnescape(rawValue)
+		if err != nil {
+			value = rawValue
+		}
+		if redacted := r.redact(key, value); redacted != value {
+			params[i] = rawKey + "=" + url.QueryEscape(redacted)
+		} else if !ok {
+			params[i] = rawKey
+		}
+	}
+	c := *u
+	c.RawQuery = strings.Join(params, "&")
+	return c.String()
+}
+
+// redact 字段名匹配时整个值替换，否则只替换值中匹配的部分
+func (r *redactor) redact(key string, value string) string {
+	if r.key.MatchString(key) {
+		return r.mask
+	}
+	return r.redactString(value)
+}
+
+// redactString 替换字符串中匹配值规则的部分
+func (r *redactor) redactString(s string) string {
+	for _, re := range r.values {
+		s = re.ReplaceAllString(s, r.mask)
+	}
+	return cardNumber.ReplaceAllStringFunc(s, func(m string) string {
+		if luhn(m) {
+			return r.mask
+		}
+		return m
+	})
+}
+
+// redactLine 对一行JSON日志脱敏。字段名匹配时替换整个值，
+// 值的规则作用于解码后的字符串和数字，替换后仍为合法的JSON。不是JSON时按字符串替换
+func (r *redactor) redactLine(p []byte) []byte {
+	s := r.field.ReplaceAllString(string(p), "${1}"+r.quotedMask)
+	if !json.Valid([]byte(s)) {
+		return []byte(r.redactString(s))
+	}
+	return r.redactJSON(s)
+}
+
+// redactJSON 逐个处理JSON中的字符串和数字：字符串解码后脱敏，脱敏后重新编码；
+// 通过Luhn校验的卡号形式的数字替换为字符串形式的mask
+func (r *redactor) redactJSON(s string) []byte {
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '"':
+			end := stringEnd(s, i)
+			literal := s[i:end]
+			var decoded string
+			if err := json.Unmarshal([]byte(literal), &decoded); err == nil {
+				if redacted := r.redactString(decoded); redacted != decoded {
+					literal = encodeString(redacted)
+				}
+			}
+			b.WriteString(literal)
+			i = end
+		case c == '-' || (c >= '0' && c <= '9'):
+			end := i + 1
+			for end < len(s) && strings.IndexByte("0123456789.eE+-", s[end]) >= 0 {
+				end++
+			}
+			if number := s[i:end]; cardNumber.MatchString(number) && luhn(number) {
+				b.WriteString(r.jsonMask)
+			} else {
+				b.WriteString(number)
+			}
+			i = end
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return []byte(b.String())
+}
+
+// stringEnd JSON字符串（从start的引号开始）结束后的位置
+func stringEnd(s string, start int) int {
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+// encodeString 编码为JSON字符串，和zerolog一样不转义HTML字符
+func encodeString(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// redactObject 把带 `log:"redact"` 标签的字段替换掉。没有标签的类型原样返回
+func (r *redactor) redactObject(i interface{}) interface{} {
+	if i == nil || !hasRedactTag(reflect.TypeOf(i)) {
+		return i
+	}
+	return r.redactValue(reflect.ValueOf(i))
+}
+
+func (r *redactor) redactValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return r.redactValue(v.Elem())
+	case reflect.Struct:
+		if !hasRedactTag(v.Type()) {
+			return v.Interface()
+		}
+		m := make(map[string]interface{}, v.NumField())
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, ok := fieldName(f)
+			if !ok {
+				continue
+			}
+			if f.Tag.Get("log") == "redact" {
+				m[name] = r.mask
+				continue
+			}
+			m[name] = r.redactValue(v.Field(i))
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		if !hasRedactTag(v.Type()) {
+			return v.Interface()
+		}
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		s := make([]interface{}, v.Len())
+		for i := range s {
+			s[i] = r.redactValue(v.Index(i))
+		}
+		return s
+	case reflect.Map:
+		if !hasRedactTag(v.Type()) {
+			return v.Interface()
+		}
+		if v.IsNil() {
+			return nil
+		}
+		m := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			m[fmt.Sprint(iter.Key().Interface())] = r.redactValue(iter.Value())
+		}
+		return m
+	case reflect.Invalid:
+		return nil
+	default:
+		return v.Interface()
+	}
+}
+
+// fieldName 按json标签决定输出的字段名，不输出的字段返回false
+func fieldName(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" {
+		return "", false
+	}
+	name := f.Name
+	if tag := f.Tag.Get("json"); tag != "" {
+		if tag == "-" {
+			return "", false
+		}
+		if n := strings.Split(tag, ",")[0]; n != "" {
+			name = n
+		}
+	}
+	return name, true
+}
+
+// 各类型是否（直接或间接）含有 `log:"redact"` 标签
+var redactTagCache sync.Map
+
+func hasRedactTag(t reflect.Type) bool {
+	if v, ok := redactTagCache.Load(t); ok {
+		return v.(bool)
+	}
+	found := findRedactTag(t, map[reflect.Type]bool{})
+	redactTagCache.Store(t, found)
+	return found
+}
+
+// findRedactTag 递归查找标签，visited 防止递归类型无限循环
+func findRedactTag(t reflect.Type, visited map[reflect.Type]bool) bool {
+	if visited[t] {
+		return false
+	}
+	visited[t] = true
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return findRedactTag(t.Elem(), visited)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			if f.Tag.Get("log") == "redact" || findRedactTag(f.Type, visited) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// luhn 信用卡号的Luhn校验
+func luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
+
+// redactWriter 在写入所有输出目标前对每一行日志脱敏
+type redactWriter struct {
+	r *redactor
+	w zerolog.LevelWriter
+}
+
+func (w redactWriter) Write(p []byte) (int, error) {
+	if _, err := w.w.Write(w.r.redactLine(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w redactWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	if _, err := w.w.WriteLevel(level, w.r.redactLine(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
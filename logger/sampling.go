@@ -0,0 +1,174 @@
+package logger
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 采样策略
+const (
+	SamplingFirst = "first" // 每个周期内先全部输出前N条，之后每M条输出一条
+	SamplingToken = "token" // 令牌桶，按固定速率输出
+)
+
+const defaultSamplingPeriod = time.Minute
+
+// 不在keys中的消息的丢弃条数合计到该键下，避免消息原文成为指标的标签值
+const suppressedOtherKey = "other"
+
+// SamplingOptions 日志采样的配置
+type SamplingOptions struct {
+	Strategy   string        `mapstructure:"strategy"`   // 采样策略：first/token，为空时不采样
+	First      uint64        `mapstructure:"first"`      // first：每个周期内全部输出的条数，需大于0
+	Thereafter uint64        `mapstructure:"thereafter"` // first：超过First后每隔多少条输出一条，需大于0
+	Period     time.Duration `mapstructure:"period"`     // first：计数重置的周期，默认1分钟。也是清理不再出现的采样对象的间隔
+	Rate       float64       `mapstructure:"rate"`       // token：每秒补充的令牌数，需大于0
+	Burst      int           `mapstructure:"burst"`      // token：令牌桶的容量，默认为1
+	Keys       []string      `mapstructure:"keys"`       // 只对这些消息（或路由）采样，为空时全部采样（log/slog和标准库log的日志除外）
+}
+
+// sampleState 每个采样对象（消息或路由）的状态
+type sampleState struct {
+	count  uint64    // first：本周期内的条数
+	reset  time.Time // first：本周期的结束时间
+	tokens float64   // token：剩余的令牌数
+	last   time.Time // token：上次补充令牌的时间
+}
+
+// Sampler 按消息或路由对日志采样，并统计被丢弃的条数
+type Sampler struct {
+	opts       SamplingOptions
+	keys       map[string]bool
+	mu         sync.Mutex
+	states     map[string]*sampleState
+	sweepAt    time.Time // 下次清理states的时间
+	suppressed map[string]uint64
+}
+
+// NewSampler 生成采样器，未设定采样策略时返回nil，nil采样器不丢弃任何日志。
+// 采样策略未知或参数不合法时返回错误，避免配置错误导致日志全部被丢弃
+func NewSampler(opts SamplingOptions) (*Sampler, error) {
+	switch opts.Strategy {
+	case "":
+		return nil, nil
+	case SamplingFirst:
+		if opts.First == 0 || opts.Thereafter == 0 {
+			return nil, fmt.Errorf("log sampling first: first and thereafter must be positive")
+		}
+	case SamplingToken:
+		if opts.Rate <= 0 {
+			return nil, fmt.Errorf("log sampling token: rate %v must be positive", opts.Rate)
+		}
+	default:
+		return nil, fmt.Errorf("log sampling strategy %q not supported", opts.Strategy)
+	}
+	if opts.Period <= 0 {
+		opts.Period = defaultSamplingPeriod
+	}
+	if opts.Burst <= 0 {
+		opts.Burst = 1
+	}
+
+	s := &Sampler{
+		opts:       opts,
+		states:     map[string]*sampleState{},
+		suppressed: map[string]uint64{},
+	}
+	if len(opts.Keys) > 0 {
+		s.keys = make(map[string]bool, len(opts.Keys))
+		for _, k := range opts.Keys {
+			s.keys[k] = true
+		}
+	}
+	return s, nil
+}
+
+// Allow 判断这条日志是否输出，不输出时计入丢弃条数
+func (s *Sampler) Allow(key string) bool {
+	if s == nil || (s.keys != nil && !s.keys[key]) {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+	st, ok := s.states[key]
+	if !ok {
+		st = &sampleState{reset: now.Add(s.opts.Period), tokens: float64(s.opts.Burst), last: now}
+		s.states[key] = st
+	}
+
+	var allow bool
+	switch s.opts.Strategy {
+	case SamplingToken:
+		st.tokens += now.Sub(st.last).Seconds() * s.opts.Rate
+		if st.tokens > float64(s.opts.Burst) {
+			st.tokens = float64(s.opts.Burst)
+		}
+		st.last = now
+		if st.tokens >= 1 {
+			st.tokens--
+			allow = true
+		}
+	default:
+		if now.After(st.reset) {
+			st.count = 0
+			st.reset = now.Add(s.opts.Period)
+		}
+		st.count++
+		allow = st.count <= s.opts.First ||
+			(s.opts.Thereafter > 0 && (st.count-s.opts.First)%s.opts.Thereafter == 0)
+	}
+
+	if !allow {
+		if s.keys[key] {
+			s.suppressed[key]++
+		} else {
+			s.suppressed[suppressedOtherKey]++
+		}
+	}
+	return allow
+}
+
+// Listed 是否在keys中明确指定了该消息（或路由）
+func (s *Sampler) Listed(key string) bool {
+	return s != nil && s.keys[key]
+}
+
+// sweep 删除已回到初始状态的采样对象，避免消息种类很多时states无限增长。最多每个周期执行一次
+func (s *Sampler) sweep(now time.Time) {
+	if now.Before(s.sweepAt) {
+		return
+	}
+	s.sweepAt = now.Add(s.opts.Period)
+	for k, st := range s.states {
+		var idle bool
+		switch s.opts.Strategy {
+		case SamplingToken:
+			idle = st.tokens+now.Sub(st.last).Seconds()*s.opts.Rate >= float64(s.opts.Burst)
+		default:
+			idle = now.After(st.reset)
+		}
+		if idle {
+			delete(s.states, k)
+		}
+	}
+}
+
+// Suppressed 各消息（或路由）被丢弃的累计条数
+func (s *Sampler) Suppressed() map[string]uint64 {
+	counts := map[string]uint64{}
+	if s == nil {
+		return counts
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, v := range s.suppressed {
+		counts[k] = v
+	}
+	return counts
+}
@@ -0,0 +1,119 @@
+package logger
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnit_samplerFirst(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := NewSampler(SamplingOptions{Strategy: SamplingFirst, First: 2, Thereafter: 3, Keys: []string{"probe"}})
+	assert.NoError(err)
+
+	var allowed []int
+	for i := 1; i <= 10; i++ {
+		if s.Allow("probe") {
+			allowed = append(allowed, i)
+		}
+	}
+	// 前2条全部输出，之后每3条输出一条
+	assert.Equal([]int{1, 2, 5, 8}, allowed)
+	assert.Equal(uint64(6), s.Suppressed()["probe"])
+
+	// 不在采样对象中的消息全部输出
+	for i := 0; i < 10; i++ {
+		assert.True(s.Allow("other"))
+	}
+	assert.Zero(s.Suppressed()["other"])
+}
+
+func TestUnit_samplerToken(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := NewSampler(SamplingOptions{Strategy: SamplingToken, Rate: 100, Burst: 2})
+	assert.NoError(err)
+	assert.True(s.Allow("probe"))
+	assert.True(s.Allow("probe"))
+	assert.False(s.Allow("probe"))
+
+	time.Sleep(20 * time.Millisecond)
+	assert.True(s.Allow("probe"))
+}
+
+func TestUnit_samplerNil(t *testing.T) {
+	s, err := NewSampler(SamplingOptions{})
+	assert.NoError(t, err)
+	assert.Nil(t, s)
+	assert.True(t, s.Allow("probe"))
+	assert.Empty(t, s.Suppressed())
+}
+
+func TestUnit_samplerSweep(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := NewSampler(SamplingOptions{Strategy: SamplingFirst, First: 1, Thereafter: 1000, Period: 10 * time.Millisecond})
+	assert.NoError(err)
+	for i := 0; i < 100; i++ {
+		s.Allow(fmt.Sprintf("request %d", i))
+		s.Allow(fmt.Sprintf("request %d", i))
+	}
+	// 不在keys中的消息的丢弃条数合计为other
+	assert.Equal(map[string]uint64{suppressedOtherKey: 100}, s.Suppressed())
+
+	// 周期结束后回到初始状态的采样对象被清理
+	time.Sleep(20 * time.Millisecond)
+	s.Allow("next")
+	s.mu.Lock()
+	assert.Len(s.states, 1)
+	s.mu.Unlock()
+}
+
+func TestUnit_samplerStdlib(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "stdlib.log")
+	l, err := NewLoggerWithOptions(Options{
+		Level:       "info",
+		ServiceName: "test",
+		Outputs:     []OutputOptions{{Type: OutputFile, Path: path}},
+		Sampling:    SamplingOptions{Strategy: SamplingFirst, First: 1, Thereafter: 1000},
+	})
+	assert.NoError(err)
+
+	// 标准库log的日志不在keys中时不采样，也不生成采样状态
+	sl := slog.New(l.SlogHandler())
+	for i := 0; i < 3; i++ {
+		sl.Info("access line")
+	}
+	assert.NoError(l.Close())
+	assert.Len(readLines(t, path), 4)
+	assert.Empty(l.Suppressed())
+	l.sampler.mu.Lock()
+	assert.Empty(l.sampler.states)
+	l.sampler.mu.Unlock()
+}
+
+func TestUnit_samplerInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, opts := range []SamplingOptions{
+		{Strategy: "frist", First: 1, Thereafter: 10},
+		{Strategy: SamplingFirst, Thereafter: 10},
+		{Strategy: SamplingFirst, First: 1},
+		{Strategy: SamplingToken},
+		{Strategy: SamplingToken, Rate: -1},
+	} {
+		_, err := NewSampler(opts)
+		assert.Error(err, opts)
+	}
+
+	// 日志部品和其他配置错误一样返回错误
+	_, err := NewLoggerWithOptions(Options{Level: "info", Sampling: SamplingOptions{Strategy: "frist"}})
+	assert.Error(err)
+}
@@ -0,0 +1,179 @@
+package logger
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"runtime"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// slogHandler 把log/slog的日志写入LoggerProvider，和其他日志一样经过采样、脱敏后输出到所有输出目标
+type slogHandler struct {
+	l      *LoggerProvider
+	attrs  []groupedAttr // WithAttrs 追加的属性
+	groups []string      // WithGroup 追加的分组
+}
+
+// groupedAttr 追加属性时所在的分组
+type groupedAttr struct {
+	groups []string
+	attr   slog.Attr
+}
+
+// loggerKey 上下文中请求范围的 slog.Logger 的键
+type loggerKey struct{}
+
+// ContextWithLogger 把请求范围的 slog.Logger（如附带了trace ID、请求ID的Logger）放入上下文
+func ContextWithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// LoggerFromContext 上下文中请求范围的 slog.Logger，没有时为 slog.Default()
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// SlogHandler 返回以LoggerProvider为输出的slog.Handler
+func (l *LoggerProvider) SlogHandler() slog.Handler {
+	return &slogHandler{l: l}
+}
+
+// SetDefault 把LoggerProvider设为log/slog的默认输出，标准库log的输出也随之写入LoggerProvider
+func (l *LoggerProvider) SetDefault() {
+	// 时间等信息由LoggerProvider输出，不需要标准库log的前缀
+	log.SetFlags(0)
+	log.SetPrefix("")
+	slog.SetDefault(slog.New(l.SlogHandler()))
+}
+
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return slogLevel(level) >= zerolog.GlobalLevel()
+}
+
+func (h *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	level := slogLevel(r.Level)
+	// 标准库log的日志（如访问日志）每条的消息都不同，只对keys中明确指定的消息采样，
+	// 避免每条消息都生成采样状态和丢弃计数
+	if h.l != nil && h.l.sampler.Listed(r.Message) && !h.l.sample(level, r.Message) {
+		return nil
+	}
+
+	fields := map[string]interface{}{}
+	for _, a := range h.attrs {
+		h.put(fields, a.groups, a.attr)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		h.put(fields, h.groups, a)
+		return true
+	})
+	// 以 slog.InfoContext 等输出时，附带上下文中span的trace ID和span ID
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		fields["trace_id"] = sc.TraceID().String()
+		fields["span_id"] = sc.SpanID().String()
+	}
+
+	e := h.l.logger().WithLevel(level)
+	if !r.Time.IsZero() {
+		e = e.Time(zerolog.TimestampFieldName, r.Time)
+	} else {
+		e = e.Timestamp()
+	}
+	if h.l != nil && h.l.caller && r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		e = e.Str("func", frame.Function).Int("line", frame.Line)
+	}
+	e.Fields(fields).Msg(r.Message)
+	return nil
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = append([]groupedAttr{}, h.attrs...)
+	for _, a := range attrs {
+		h2.attrs = append(h2.attrs, groupedAttr{groups: h.groups, attr: a})
+	}
+	return &h2
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.groups = append(append([]string{}, h.groups...), name)
+	return &h2
+}
+
+// put 把属性放到所在分组对应的嵌套map中
+func (h *slogHandler) put(fields map[string]interface{}, groups []string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	for _, g := range groups {
+		sub, ok := fields[g].(map[string]interface{})
+		if !ok {
+			sub = map[string]interface{}{}
+			fields[g] = sub
+		}
+		fields = sub
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		attrs := a.Value.Group()
+		if len(attrs) == 0 {
+			return
+		}
+		// 键为空的分组，属性直接展开到当前分组
+		var sub []string
+		if a.Key != "" {
+			sub = []string{a.Key}
+		}
+		for _, ga := range attrs {
+			h.put(fields, sub, ga)
+		}
+		return
+	}
+	fields[a.Key] = h.value(a.Value)
+}
+
+// value 把slog的值转换为输出用的值
+func (h *slogHandler) value(v slog.Value) interface{} {
+	switch v.Kind() {
+	case slog.KindDuration:
+		return v.Duration().String()
+	case slog.KindTime:
+		return v.Time().Format(time.RFC3339Nano)
+	case slog.KindAny:
+		a := v.Any()
+		if err, ok := a.(error); ok {
+			return err.Error()
+		}
+		return h.l.redactObject(a)
+	default:
+		return v.Any()
+	}
+}
+
+// slogLevel 把slog的级别转换为zerolog的级别
+func slogLevel(level slog.Level) zerolog.Level {
+	switch {
+	case level >= slog.LevelError:
+		return zerolog.ErrorLevel
+	case level >= slog.LevelWarn:
+		return zerolog.WarnLevel
+	case level >= slog.LevelInfo:
+		return zerolog.InfoLevel
+	case level >= slog.LevelDebug:
+		return zerolog.DebugLevel
+	default:
+		return zerolog.TraceLevel
+	}
+}
@@ -0,0 +1,150 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	stdlog "log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/environment"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// readLines 读取日志文件中的每一行JSON
+func readLines(t *testing.T, path string) []map[string]interface{} {
+	b, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	var lines []map[string]interface{}
+	for _, s := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var m map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(s), &m), s)
+		lines = append(lines, m)
+	}
+	return lines
+}
+
+func TestUnit_adapters(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "adapters.log")
+	l, err := NewLoggerWithOptions(Options{
+		Level:       "info",
+		ServiceName: "test",
+		Caller:      true,
+		Outputs:     []OutputOptions{{Type: OutputFile, Path: path}},
+	})
+	assert.NoError(err)
+
+	// log/slog
+	sl := slog.New(l.SlogHandler()).With("component", "slog").WithGroup("req")
+	sl.Info("slog info", "id", 1, slog.Group("user", "name", "alice", "token", "abc"))
+	sl.Debug("slog debug") // 低于输出级别
+
+	// go-logr
+	lr := l.Logr().WithName("controller").WithValues("component", "logr")
+	lr.Info("logr info", "id", 2)
+	lr.V(1).Info("logr debug") // 低于输出级别
+	lr.Error(errors.New("boom"), "logr error")
+
+	// 标准库log
+	flags, prefix, out := stdlog.Flags(), stdlog.Prefix(), stdlog.Writer()
+	defaultLogger := slog.Default()
+	l.SetDefault()
+	stdlog.Printf("stdlib %d", 3)
+	slog.SetDefault(defaultLogger)
+	stdlog.SetFlags(flags)
+	stdlog.SetPrefix(prefix)
+	stdlog.SetOutput(out)
+
+	assert.NoError(l.Close())
+
+	lines := readLines(t, path)
+	assert.Len(lines, 5) // 含初始化成功的日志
+
+	assert.Equal("slog info", lines[1]["message"])
+	assert.Equal("info", lines[1]["level"])
+	assert.Equal("slog", lines[1]["component"])
+	assert.Equal(map[string]interface{}{
+		"id":   float64(1),
+		"user": map[string]interface{}{"name": "alice", "token": defaultMask},
+	}, lines[1]["req"])
+	assert.Contains(lines[1]["func"], "TestUnit_adapters")
+
+	assert.Equal("logr info", lines[2]["message"])
+	assert.Equal("controller", lines[2]["logger"])
+	assert.Equal("logr", lines[2]["component"])
+	assert.Equal(float64(2), lines[2]["id"])
+	assert.Contains(lines[2]["func"], "TestUnit_adapters")
+
+	assert.Equal("logr error", lines[3]["message"])
+	assert.Equal("error", lines[3]["level"])
+	assert.Equal("boom", lines[3]["error"])
+
+	assert.Equal("stdlib 3", lines[4]["message"])
+	assert.Equal("info", lines[4]["level"])
+}
+
+func TestUnit_slogTraceContext(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "trace.log")
+	l, err := NewLoggerWithOptions(Options{
+		Level:       "info",
+		ServiceName: "test",
+		Outputs:     []OutputOptions{{Type: OutputFile, Path: path}},
+	})
+	assert.NoError(err)
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled,
+	}))
+
+	sl := slog.New(l.SlogHandler())
+	sl.InfoContext(ctx, "with trace")
+	sl.Info("without trace")
+	assert.NoError(l.Close())
+
+	lines := readLines(t, path)
+	if assert.Len(lines, 3) {
+		assert.Equal("4bf92f3577b34da6a3ce929d0e0e4736", lines[1]["trace_id"])
+		assert.Equal("00f067aa0ba902b7", lines[1]["span_id"])
+		assert.NotContains(lines[2], "trace_id")
+	}
+}
+
+func TestUnit_defaultFields(t *testing.T) {
+	assert := assert.New(t)
+
+	saved := environment.Pod
+	environment.Pod = environment.PodMeta{Name: "httpserver-0", Namespace: "homework", NodeName: "node-1"}
+	defer func() { environment.Pod = saved }()
+
+	path := filepath.Join(t.TempDir(), "fields.log")
+	l, err := NewLoggerWithOptions(Options{
+		Level:       "info",
+		ServiceName: "test",
+		Outputs:     []OutputOptions{{Type: OutputFile, Path: path}},
+		Fields:      map[string]string{"team": "platform", "node": ""},
+	})
+	assert.NoError(err)
+	l.Info("with fields")
+	assert.NoError(l.Close())
+
+	lines := readLines(t, path)
+	if assert.Len(lines, 2) {
+		assert.Equal("httpserver-0", lines[1]["pod"])
+		assert.Equal("homework", lines[1]["namespace"])
+		assert.Equal("platform", lines[1]["team"])
+		// 值为空时删除默认的字段
+		assert.NotContains(lines[1], "node")
+	}
+}
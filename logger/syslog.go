@@ -0,0 +1,20 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package logger
+
+import (
+	"io"
+	"log/syslog"
+
+	"github.com/rs/zerolog"
+)
+
+// newSyslog 连接syslog服务，按日志级别写入对应的syslog优先级
+func newSyslog(network, address, tag string) (io.Writer, io.Closer, error) {
+	w, err := syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, nil, err
+	}
+	return zerolog.SyslogLevelWriter(w), w, nil
+}
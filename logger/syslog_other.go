@@ -0,0 +1,14 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package logger
+
+import (
+	"errors"
+	"io"
+)
+
+// newSyslog 当前平台没有syslog
+func newSyslog(network, address, tag string) (io.Writer, io.Closer, error) {
+	return nil, nil, errors.New("log output syslog not supported on this platform")
+}
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// OtherLabelValue 超过标签组合上限的观测值归入的标签值
+const OtherLabelValue = "other"
+
+const droppedObservationsName = "httpserver_metrics_dropped_observations_total"
+
+// CardinalityOptions 各指标标签组合数的上限，防止请求方法等由客户端决定的标签值导致时间序列无限增长
+type CardinalityOptions struct {
+	Limit  int            `mapstructure:"limit"`  // 每个指标的标签组合数上限，为0时不限制
+	Limits map[string]int `mapstructure:"limits"` // 按指标名设定上限，优先于limit
+}
+
+// seriesLimiter 记录各指标已有的标签组合
+type seriesLimiter struct {
+	mu   sync.Mutex
+	seen map[string]map[string]struct{}
+}
+
+var (
+	limiter             = &seriesLimiter{seen: map[string]map[string]struct{}{}}
+	droppedObservations *prometheus.CounterVec
+)
+
+// registerCardinality 注册因超过上限而归入other的观测值的计数
+func registerCardinality(r *prometheus.Registry) {
+	droppedObservations = named(droppedObservationsName, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: droppedObservationsName,
+		Help: "The total number of observations folded into the other series because the label combination exceeded the cardinality limit.",
+	}, []string{"metric"}))
+	r.MustRegister(droppedObservations)
+}
+
+// cardinalityLimit 指标的标签组合数上限
+func cardinalityLimit(name string) int {
+	if l, ok := options.Cardinality.Limits[name]; ok {
+		return l
+	}
+	return options.Cardinality.Limit
+}
+
+// limitLabels 标签组合数未超过上限时原样返回，超过时所有标签值替换为other。
+// other的组合不计入上限，所以每个指标最多有上限+1个时间序列。
+func limitLabels(name string, values []string) []string {
+	if len(values) == 0 || !overLimit(name, values) {
+		return values
+	}
+	other := make([]string, len(values))
+	for i := range other {
+		other[i] = OtherLabelValue
+	}
+	return other
+}
+
+// limitLabelMap 对map形式的标签应用上限
+func limitLabelMap(name string, labels map[string]string) map[string]string {
+	names := labelNames(labels)
+	values := make([]string, len(names))
+	for i, n := range names {
+		values[i] = labels[n]
+	}
+	if len(values) == 0 || !overLimit(name, values) {
+		return labels
+	}
+	other := make(map[string]string, len(names))
+	for _, n := range names {
+		other[n] = OtherLabelValue
+	}
+	return other
+}
+
+// folded 所有标签值都是other，即已经归入other的组合，经过多个 MetricsRecorder 时不重复计数
+func folded(values []string) bool {
+	for _, v := range values {
+		if v != OtherLabelValue {
+			return false
+		}
+	}
+	return true
+}
+
+// overLimit 判断标签组合是否超过上限，超过时计入丢弃的计数
+func overLimit(name string, values []string) bool {
+	limit := cardinalityLimit(name)
+	if limit <= 0 {
+		return false
+	}
+	if folded(values) {
+		return false
+	}
+	key := strings.Join(values, "\xff")
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	set, ok := limiter.seen[name]
+	if !ok {
+		set = map[string]struct{}{}
+		limiter.seen[name] = set
+	}
+	if _, ok := set[key]; ok {
+		return false
+	}
+	if len(set) < limit {
+		set[key] = struct{}{}
+		return false
+	}
+
+	if droppedObservations != nil {
+		droppedObservations.WithLabelValues(name).Inc()
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnit_limitLabels(t *testing.T) {
+	assert := assert.New(t)
+
+	savedOptions, savedLimiter, savedDropped := options, limiter, droppedObservations
+	defer func() { options, limiter, droppedObservations = savedOptions, savedLimiter, savedDropped }()
+	options = Options{Cardinality: CardinalityOptions{Limit: 2, Limits: map[string]int{"jobs_total": 1}}}
+	limiter = &seriesLimiter{seen: map[string]map[string]struct{}{}}
+	r := prometheus.NewRegistry()
+	registerCardinality(r)
+
+	assert.Equal([]string{"/info", "GET"}, limitLabels(httpRequestsTotalName, []string{"/info", "GET"}))
+	assert.Equal([]string{"/info", "POST"}, limitLabels(httpRequestsTotalName, []string{"/info", "POST"}))
+	// 已有的组合不受上限影响
+	assert.Equal([]string{"/info", "GET"}, limitLabels(httpRequestsTotalName, []string{"/info", "GET"}))
+	assert.Equal([]string{OtherLabelValue, OtherLabelValue}, limitLabels(httpRequestsTotalName, []string{"/info", "BREW"}))
+	assert.Equal([]string{OtherLabelValue, OtherLabelValue}, limitLabels(httpRequestsTotalName, []string{"/", "BREW"}))
+	// 上限按指标分别计算
+	assert.Equal([]string{"/info", "BREW"}, limitLabels(httpRequestDurationName, []string{"/info", "BREW"}))
+
+	// 按指标名设定的上限优先
+	p := NewPrometheusRecorder(r)
+	p.AddCounter(context.Background(), "jobs_total", 1, map[string]string{"queue": "mail"})
+	p.AddCounter(context.Background(), "jobs_total", 1, map[string]string{"queue": "sms"})
+	p.AddCounter(context.Background(), "jobs_total", 1, map[string]string{"queue": "push"})
+
+	assert.NoError(testutil.GatherAndCompare(r, strings.NewReader(`
+# HELP httpserver_metrics_dropped_observations_total The total number of observations folded into the other series because the label combination exceeded the cardinality limit.
+# TYPE httpserver_metrics_dropped_observations_total counter
+httpserver_metrics_dropped_observations_total{metric="httpserver_http_requests_total"} 2
+httpserver_metrics_dropped_observations_total{metric="jobs_total"} 2
+# HELP jobs_total jobs_total recorded through MetricsRecorder.
+# TYPE jobs_total counter
+jobs_total{queue="mail"} 1
+jobs_total{queue="other"} 2
+`), droppedObservationsName, "jobs_total"))
+}
@@ -0,0 +1,377 @@
+package metrics
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	dashboardSchemaVersion = 39
+	dashboardPanelHeight   = 8
+	dashboardWidth         = 24
+	dashboardSelector      = `namespace=~"$namespace"`
+	dashboardRateInterval  = "$__rate_interval"
+	dashboardDatasourceID  = "${datasource}"
+)
+
+// 运行时指标（process 和 Go 的collector）
+const (
+	processCPUName      = "process_cpu_seconds_total"
+	processResidentName = "process_resident_memory_bytes"
+	processOpenFDsName  = "process_open_fds"
+	goGoroutinesName    = "go_goroutines"
+	goHeapAllocName     = "go_memstats_heap_alloc_bytes"
+	goGCDurationName    = "go_gc_duration_seconds"
+)
+
+// DashboardOptions 生成Grafana仪表盘的配置
+type DashboardOptions struct {
+	Title string // 标题，默认为 Http Server
+	UID   string // 仪表盘的UID，默认为 httpserver
+}
+
+// Dashboard Grafana仪表盘的JSON模型
+type Dashboard struct {
+	UID           string           `json:"uid"`
+	Title         string           `json:"title"`
+	Tags          []string         `json:"tags"`
+	Editable      bool             `json:"editable"`
+	SchemaVersion int              `json:"schemaVersion"`
+	Refresh       string           `json:"refresh"`
+	Time          DashboardTime    `json:"time"`
+	Templating    DashboardVarList `json:"templating"`
+	Panels        []Panel          `json:"panels"`
+}
+
+// DashboardTime 默认的时间范围
+type DashboardTime struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// DashboardVarList 仪表盘的变量
+type DashboardVarList struct {
+	List []DashboardVariable `json:"list"`
+}
+
+// DashboardVariable 仪表盘的变量
+type DashboardVariable struct {
+	Name       string           `json:"name"`
+	Label      string           `json:"label"`
+	Type       string           `json:"type"`
+	Query      interface{}      `json:"query"`
+	Datasource *PanelDatasource `json:"datasource,omitempty"`
+	Refresh    int              `json:"refresh,omitempty"`
+	IncludeAll bool             `json:"includeAll"`
+	AllValue   string           `json:"allValue,omitempty"`
+	Multi      bool             `json:"multi"`
+	Current    interface{}      `json:"current"`
+}
+
+// Panel 仪表盘的面板
+type Panel struct {
+	ID          int                    `json:"id"`
+	Type        string                 `json:"type"`
+	Title       string                 `json:"title"`
+	Datasource  *PanelDatasource       `json:"datasource,omitempty"`
+	GridPos     GridPos                `json:"gridPos"`
+	Targets     []PanelTarget          `json:"targets,omitempty"`
+	FieldConfig *PanelFieldConfig      `json:"fieldConfig,omitempty"`
+	Options     map[string]interface{} `json:"options,omitempty"`
+	Panels      []Panel                `json:"panels,omitempty"`
+}
+
+// PanelDatasource 面板使用的数据源，通过变量选择
+type PanelDatasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+// GridPos 面板的位置和大小，宽度共24格
+type GridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// PanelTarget 面板的查询
+type PanelTarget struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+	Format       string `json:"format,omitempty"`
+	Exemplar     bool   `json:"exemplar,omitempty"`
+}
+
+// PanelFieldConfig 面板的单位等设定
+type PanelFieldConfig struct {
+	Defaults  PanelFieldDefaults `json:"defaults"`
+	Overrides []interface{}      `json:"overrides"`
+}
+
+// PanelFieldDefaults 面板字段的默认设定
+type PanelFieldDefaults struct {
+	Unit string `json:"unit,omitempty"`
+}
+
+// dashboardBuilder 按行排列面板
+type dashboardBuilder struct {
+	panels []Panel
+	nextID int
+	x, y   int
+}
+
+// row 开始新的一行
+func (b *dashboardBuilder) row(title string) {
+	b.newLine()
+	b.nextID++
+	b.panels = append(b.panels, Panel{ID: b.nextID, Type: "row", Title: title, GridPos: GridPos{H: 1, W: dashboardWidth, Y: b.y}, Panels: []Panel{}})
+	b.y++
+}
+
+// add 添加宽度为w的面板，当前行放不下时换行
+func (b *dashboardBuilder) add(p Panel, w int) {
+	if b.x+w > dashboardWidth {
+		b.newLine()
+	}
+	b.nextID++
+	p.ID = b.nextID
+	p.Datasource = &PanelDatasource{Type: "prometheus", UID: dashboardDatasourceID}
+	p.GridPos = GridPos{H: dashboardPanelHeight, W: w, X: b.x, Y: b.y}
+	for i := range p.Targets {
+		p.Targets[i].RefID = string(rune('A' + i))
+	}
+	b.panels = append(b.panels, p)
+	b.x += w
+}
+
+func (b *dashboardBuilder) newLine() {
+	if b.x > 0 {
+		b.x = 0
+		b.y += dashboardPanelHeight
+	}
+}
+
+// timeseries 折线图
+func timeseries(title, unit string, targets ...PanelTarget) Panel {
+	return Panel{
+		Type:        "timeseries",
+		Title:       title,
+		Targets:     targets,
+		FieldConfig: &PanelFieldConfig{Defaults: PanelFieldDefaults{Unit: unit}, Overrides: []interface{}{}},
+		Options: map[string]interface{}{
+			"legend":  map[string]interface{}{"displayMode": "list", "placement": "bottom", "showLegend": true},
+			"tooltip": map[string]interface{}{"mode": "multi", "sort": "desc"},
+		},
+	}
+}
+
+// heatmap 直方图的分布，bucket已由Prometheus计算好
+func heatmap(title, name string) Panel {
+	return Panel{
+		Type:  "heatmap",
+		Title: title,
+		Targets: []PanelTarget{{
+			Expr:         fmt.Sprintf("sum by (le) (increase(%s_bucket{%s}[%s]))", name, dashboardSelector, dashboardRateInterval),
+			LegendFormat: "{{le}}",
+			Format:       "heatmap",
+		}},
+		FieldConfig: &PanelFieldConfig{Overrides: []interface{}{}},
+		Options: map[string]interface{}{
+			"calculate": false,
+			"cellGap":   1,
+			"color":     map[string]interface{}{"mode": "scheme", "scheme": "Spectral", "steps": 64},
+			"yAxis":     map[string]interface{}{"unit": "s"},
+			"exemplars": map[string]interface{}{"color": "rgba(255,0,255,0.7)"},
+			"tooltip":   map[string]interface{}{"mode": "single", "yHistogram": true},
+		},
+	}
+}
+
+// percentiles 直方图的p50/p90/p99，附带exemplar以便跳转到具体的请求
+func percentiles(title, name, by string) Panel {
+	var targets []PanelTarget
+	for _, q := range rulesQuantiles {
+		legend := fmt.Sprintf("p%g", q*100)
+		if by != "" {
+			legend = fmt.Sprintf("p%g {{%s}}", q*100, by)
+		}
+		targets = append(targets, PanelTarget{
+			Expr:         fmt.Sprintf("histogram_quantile(%g, sum by (%sle) (rate(%s_bucket{%s}[%s])))", q, byPrefix(by), name, dashboardSelector, dashboardRateInterval),
+			LegendFormat: legend,
+			Exemplar:     true,
+		})
+	}
+	return timeseries(title, "s", targets...)
+}
+
+func byPrefix(by string) string {
+	if by == "" {
+		return ""
+	}
+	return by + ", "
+}
+
+// GenerateDashboard 按注册表中实际注册的指标生成Grafana仪表盘，没有注册的指标不生成相应的面板
+func GenerateDashboard(r prometheus.Collector, opts DashboardOptions) Dashboard {
+	if opts.Title == "" {
+		opts.Title = "Http Server"
+	}
+	if opts.UID == "" {
+		opts.UID = "httpserver"
+	}
+	names := RegisteredNames(r)
+	sel := "{" + dashboardSelector + "}"
+	rate := func(name string, matchers string) string {
+		if matchers != "" {
+			matchers = dashboardSelector + "," + matchers
+		} else {
+			matchers = dashboardSelector
+		}
+		return fmt.Sprintf("rate(%s{%s}[%s])", name, matchers, dashboardRateInterval)
+	}
+
+	b := &dashboardBuilder{}
+	if names[httpRequestsTotalName] || names[httpInFlightName] {
+		b.row("Requests")
+		if names[httpRequestsTotalName] {
+			b.add(timeseries("Request rate", "reqps", PanelTarget{
+				Expr:         fmt.Sprintf("sum by (route) (%s)", rate(httpRequestsTotalName, "")),
+				LegendFormat: "{{route}}",
+			}), 8)
+			b.add(timeseries("Error ratio (5xx, aborted)", "percentunit", PanelTarget{
+				Expr: fmt.Sprintf("sum by (route) (%s) / sum by (route) (%s)",
+					rate(httpRequestsTotalName, `status_class=~"5xx|`+StatusClassAborted+`"`), rate(httpRequestsTotalName, "")),
+				LegendFormat: "{{route}}",
+			}), 8)
+		}
+		if names[httpInFlightName] {
+			b.add(timeseries("In-flight requests", "short", PanelTarget{
+				Expr:         fmt.Sprintf("sum by (route) (%s%s)", httpInFlightName, sel),
+				LegendFormat: "{{route}}",
+			}), 8)
+		}
+	}
+
+	if names[httpRequestDurationName] || names[SleepDurationName] {
+		b.row("Latency")
+		if names[httpRequestDurationName] {
+			b.add(heatmap("Request duration", httpRequestDurationName), 12)
+			b.add(percentiles("Request duration percentiles", httpRequestDurationName, "route"), 12)
+		}
+		if names[SleepDurationName] {
+			b.add(heatmap("Sleep duration", SleepDurationName), 12)
+			b.add(percentiles("Sleep duration percentiles", SleepDurationName, ""), 12)
+		}
+	}
+
+	if names[sloRemainingName] {
+		b.row("SLO")
+		b.add(timeseries("Error budget remaining", "percentunit", PanelTarget{
+			Expr:         fmt.Sprintf("min by (slo) (%s%s)", sloRemainingName, sel),
+			LegendFormat: "{{slo}}",
+		}), 12)
+		b.add(timeseries("Burn rate", "short", PanelTarget{
+			Expr:         fmt.Sprintf("max by (slo, window) (%s%s)", sloBurnRateName, sel),
+			LegendFormat: "{{slo}} {{window}}",
+		}), 12)
+	}
+
+	runtimePanels := []struct {
+		name  string
+		panel Panel
+	}{
+		{processCPUName, timeseries("CPU", "short", PanelTarget{Expr: fmt.Sprintf("sum by (pod) (%s)", rate(processCPUName, "")), LegendFormat: "{{pod}}"})},
+		{processResidentName, timeseries("Resident memory", "bytes", PanelTarget{Expr: fmt.Sprintf("sum by (pod) (%s%s)", processResidentName, sel), LegendFormat: "{{pod}}"})},
+		{goHeapAllocName, timeseries("Heap in use", "bytes", PanelTarget{Expr: fmt.Sprintf("sum by (pod) (%s%s)", goHeapAllocName, sel), LegendFormat: "{{pod}}"})},
+		{goGoroutinesName, timeseries("Goroutines", "short", PanelTarget{Expr: fmt.Sprintf("sum by (pod) (%s%s)", goGoroutinesName, sel), LegendFormat: "{{pod}}"})},
+		{goGCDurationName, timeseries("GC pause", "s", PanelTarget{Expr: fmt.Sprintf("max by (pod) (%s%s)", goGCDurationName, "{"+dashboardSelector+`,quantile="1"}`), LegendFormat: "{{pod}}"})},
+		{processOpenFDsName, timeseries("Open file descriptors", "short", PanelTarget{Expr: fmt.Sprintf("sum by (pod) (%s%s)", processOpenFDsName, sel), LegendFormat: "{{pod}}"})},
+		{containerMemoryUsageName, timeseries("Container memory", "bytes",
+			PanelTarget{Expr: fmt.Sprintf("sum by (pod) (%s%s)", containerMemoryUsageName, sel), LegendFormat: "{{pod}} usage"},
+			PanelTarget{Expr: fmt.Sprintf("max by (pod) (%s%s)", containerMemoryLimitName, sel), LegendFormat: "{{pod}} limit"},
+			PanelTarget{Expr: fmt.Sprintf("max by (pod) (%s%s)", goSoftMemoryLimitName, sel), LegendFormat: "{{pod}} GOMEMLIMIT"},
+		)},
+		{containerCPUQuotaName, timeseries("CPU usage / quota", "percentunit", PanelTarget{
+			Expr:         fmt.Sprintf("sum by (pod) (%s) / max by (pod) (%s%s > 0)", rate(processCPUName, ""), containerCPUQuotaName, sel),
+			LegendFormat: "{{pod}}",
+		})},
+	}
+	rowAdded := false
+	for _, p := range runtimePanels {
+		if !names[p.name] {
+			continue
+		}
+		if !rowAdded {
+			b.row("Runtime")
+			rowAdded = true
+		}
+		b.add(p.panel, 8)
+	}
+
+	if names[lifecycleStateName] || names[uptimeName] || names[buildInfoName] {
+		b.row("Lifecycle")
+		if names[lifecycleStateName] {
+			b.add(timeseries("Pods by lifecycle state", "short", PanelTarget{
+				Expr:         fmt.Sprintf("sum by (state) (%s%s)", lifecycleStateName, sel),
+				LegendFormat: "{{state}}",
+			}), 12)
+		}
+		if names[uptimeName] {
+			b.add(timeseries("Uptime", "s", PanelTarget{
+				Expr:         fmt.Sprintf("max by (pod) (%s%s)", uptimeName, sel),
+				LegendFormat: "{{pod}}",
+			}), 6)
+		}
+		if names[buildInfoName] {
+			b.add(timeseries("Pods by version", "short", PanelTarget{
+				Expr:         fmt.Sprintf("count by (version) (%s%s)", buildInfoName, sel),
+				LegendFormat: "{{version}}",
+			}), 6)
+		}
+	}
+
+	return Dashboard{
+		UID:           opts.UID,
+		Title:         opts.Title,
+		Tags:          []string{"httpserver", "generated"},
+		Editable:      true,
+		SchemaVersion: dashboardSchemaVersion,
+		Refresh:       "30s",
+		Time:          DashboardTime{From: "now-1h", To: "now"},
+		Templating: DashboardVarList{List: []DashboardVariable{
+			{
+				Name:    "datasource",
+				Label:   "Data source",
+				Type:    "datasource",
+				Query:   "prometheus",
+				Current: map[string]interface{}{},
+			},
+			{
+				Name:       "namespace",
+				Label:      "Namespace",
+				Type:       "query",
+				Datasource: &PanelDatasource{Type: "prometheus", UID: dashboardDatasourceID},
+				Query:      map[string]interface{}{"query": fmt.Sprintf("label_values(%s, namespace)", dashboardVariableMetric(names)), "refId": "namespace"},
+				Refresh:    2,
+				IncludeAll: true,
+				AllValue:   ".*",
+				Multi:      true,
+				Current:    map[string]interface{}{"text": "All", "value": "$__all"},
+			},
+		}},
+		Panels: b.panels,
+	}
+}
+
+// dashboardVariableMetric 查询命名空间用的指标，优先使用每个Pod都有的构建信息
+func dashboardVariableMetric(names map[string]bool) string {
+	for _, n := range []string{buildInfoName, httpRequestsTotalName, uptimeName} {
+		if names[n] {
+			return n
+		}
+	}
+	return "up"
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnit_generateDashboard(t *testing.T) {
+	assert := assert.New(t)
+
+	r := prometheus.NewRegistry()
+	r.MustRegister(
+		// 没有时间序列的指标按生成时记录的名称取得
+		named(httpRequestsTotalName, prometheus.NewCounterVec(prometheus.CounterOpts{Name: httpRequestsTotalName, Help: "test"}, httpLabels)),
+		named(httpRequestDurationName, prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: httpRequestDurationName, Help: "test"}, httpLabels)),
+		collectors.NewGoCollector(),
+	)
+
+	d := GenerateDashboard(r, DashboardOptions{})
+	assert.Equal("httpserver", d.UID)
+	assert.Equal("Http Server", d.Title)
+	if assert.Len(d.Templating.List, 2) {
+		assert.Equal("datasource", d.Templating.List[0].Name)
+		assert.Equal("namespace", d.Templating.List[1].Name)
+		assert.Equal(map[string]interface{}{"query": "label_values(httpserver_http_requests_total, namespace)", "refId": "namespace"}, d.Templating.List[1].Query)
+	}
+
+	panels := map[string]Panel{}
+	var rows []string
+	for _, p := range d.Panels {
+		if p.Type == "row" {
+			rows = append(rows, p.Title)
+			continue
+		}
+		panels[p.Title] = p
+		assert.Equal("${datasource}", p.Datasource.UID)
+	}
+	// 没有注册的指标不生成面板
+	assert.Equal([]string{"Requests", "Latency", "Runtime"}, rows)
+	assert.NotContains(panels, "In-flight requests")
+	assert.NotContains(panels, "Sleep duration")
+	assert.NotContains(panels, "CPU")
+	assert.Contains(panels, "Goroutines")
+
+	heat := panels["Request duration"]
+	assert.Equal("heatmap", heat.Type)
+	assert.Equal("heatmap", heat.Targets[0].Format)
+	assert.Equal(`sum by (le) (increase(httpserver_http_request_duration_seconds_bucket{namespace=~"$namespace"}[$__rate_interval]))`, heat.Targets[0].Expr)
+
+	p := panels["Request duration percentiles"]
+	if assert.Len(p.Targets, 3) {
+		assert.Equal("A", p.Targets[0].RefID)
+		assert.Equal("C", p.Targets[2].RefID)
+		assert.True(p.Targets[2].Exemplar)
+		assert.Equal("p99 {{route}}", p.Targets[2].LegendFormat)
+	}
+
+	// 面板按行排列，不重叠
+	assert.Equal(GridPos{H: 8, W: 8, X: 8, Y: 1}, panels["Error ratio (5xx, aborted)"].GridPos)
+	assert.Equal(GridPos{H: 8, W: 12, X: 0, Y: 10}, heat.GridPos)
+}
@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"context"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type exemplarKey struct{}
+
+// ContextWithExemplar 把exemplar的标签（trace ID、请求ID等）放入上下文，
+// 之后用该上下文记录的直方图观测值会附带这些标签，便于从延时的尖峰跳转到具体的请求。
+func ContextWithExemplar(ctx context.Context, labels prometheus.Labels) context.Context {
+	return context.WithValue(ctx, exemplarKey{}, labels)
+}
+
+// ExemplarFromContext 取得上下文中的exemplar标签，没有时返回nil
+func ExemplarFromContext(ctx context.Context) prometheus.Labels {
+	labels, _ := ctx.Value(exemplarKey{}).(prometheus.Labels)
+	return labels
+}
+
+// exemplar标签的名称和值合计的最大字符数（OpenMetrics的规定）
+const maxExemplarRunes = 128
+
+// observe 记录观测值，有exemplar标签时一并记录。
+// 标签不合法时 ObserveWithExemplar 会panic，所以只记录观测值
+func observe(o prometheus.Observer, value float64, exemplar prometheus.Labels) {
+	if eo, ok := o.(prometheus.ExemplarObserver); ok && len(exemplar) > 0 && validExemplar(exemplar) {
+		eo.ObserveWithExemplar(value, exemplar)
+		return
+	}
+	o.Observe(value)
+}
+
+// validExemplar exemplar标签的名称和值都是UTF-8，且合计不超过128个字符
+func validExemplar(labels prometheus.Labels) bool {
+	runes := 0
+	for name, value := range labels {
+		if !utf8.ValidString(name) || !utf8.ValidString(value) {
+			return false
+		}
+		runes += utf8.RuneCountInString(name) + utf8.RuneCountInString(value)
+	}
+	return runes <= maxExemplarRunes
+}
@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnit_observeExemplar(t *testing.T) {
+	assert := assert.New(t)
+
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_seconds", Help: "test", Buckets: []float64{1}})
+	exemplar := func() *dto.Exemplar {
+		var m dto.Metric
+		assert.NoError(h.Write(&m))
+		return m.GetHistogram().GetBucket()[0].GetExemplar()
+	}
+
+	observe(h, 0.5, prometheus.Labels{"request_id": "abc"})
+	assert.Equal("abc", exemplar().GetLabel()[0].GetValue())
+
+	// 不合法的exemplar不记录，也不panic
+	for _, labels := range []prometheus.Labels{
+		{"request_id": "\xff\xfe"},
+		{"request_id": strings.Repeat("a", 129)},
+	} {
+		assert.NotPanics(func() { observe(h, 0.3, labels) })
+		assert.Equal("abc", exemplar().GetLabel()[0].GetValue())
+	}
+	var m dto.Metric
+	assert.NoError(h.Write(&m))
+	assert.Equal(uint64(3), m.GetHistogram().GetSampleCount())
+}
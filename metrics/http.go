@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/protocol"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// HTTP请求的RED（Rate/Errors/Duration）指标，按路由模式（而不是实际的URL）、请求方法和状态码类别区分
+var (
+	httpRequestsTotal   *prometheus.CounterVec
+	httpRequestDuration *prometheus.HistogramVec
+	httpRequestSize     *prometheus.HistogramVec
+	httpResponseSize    *prometheus.HistogramVec
+	httpInFlight        *prometheus.GaugeVec
+)
+
+// 指标名，生成告警规则和仪表盘时也使用这些名称
+const (
+	httpRequestsTotalName   = "httpserver_http_requests_total"
+	httpRequestDurationName = "httpserver_http_request_duration_seconds"
+	httpRequestSizeName     = "httpserver_http_request_size_bytes"
+	httpResponseSizeName    = "httpserver_http_response_size_bytes"
+	httpInFlightName        = "httpserver_http_requests_in_flight"
+)
+
+// 默认的bucket：处理时间从 50ms 到 10s，请求和应答的大小从 100B 到 100MB 按10倍增长
+var (
+	durationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	sizeBuckets     = prometheus.ExponentialBuckets(100, 10, 7)
+)
+
+// 指标的标签
+var (
+	httpLabels         = []string{"route", "method", "status_class"}
+	httpInFlightLabels = []string{"route", "method"}
+)
+
+// registerHTTP 生成并注册HTTP请求的指标
+func registerHTTP(r *prometheus.Registry) {
+	httpRequestsTotal = named(httpRequestsTotalName, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: httpRequestsTotalName,
+		Help: "The total number of handled HTTP requests.",
+	}, httpLabels))
+	// 每个 bucket 最终作为一个带有 _bucket 后缀的时间序列，使用 le（小于或等于）标签指示该 bucket 的上限，
+	// 还包括累积总和 _sum 和计数 _count。
+	httpRequestDuration = named(httpRequestDurationName, prometheus.NewHistogramVec(histogramOpts(
+		httpRequestDurationName,
+		"A histogram of the HTTP request durations in seconds.",
+		durationBuckets,
+	), httpLabels))
+	httpRequestSize = named(httpRequestSizeName, prometheus.NewHistogramVec(histogramOpts(
+		httpRequestSizeName,
+		"A histogram of the HTTP request body sizes in bytes.",
+		sizeBuckets,
+	), httpLabels))
+	httpResponseSize = named(httpResponseSizeName, prometheus.NewHistogramVec(histogramOpts(
+		httpResponseSizeName,
+		"A histogram of the HTTP response body sizes in bytes.",
+		sizeBuckets,
+	), httpLabels))
+	httpInFlight = named(httpInFlightName, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: httpInFlightName,
+		Help: "The number of HTTP requests currently being served.",
+	}, httpInFlightLabels))
+
+	r.MustRegister(httpRequestsTotal, httpRequestDuration, httpRequestSize, httpResponseSize, httpInFlight)
+}
+
+// RequestStarted 通过recorder记录开始处理的请求，返回处理结束时调用的函数
+func RequestStarted(ctx context.Context, recorder protocol.MetricsRecorder, route, method string) func() {
+	labels := map[string]string{"route": route, "method": method}
+	recorder.AddGauge(ctx, httpInFlightName, 1, labels)
+	return func() { recorder.AddGauge(ctx, httpInFlightName, -1, labels) }
+}
+
+// ObserveRequest 通过recorder记录处理完的请求，上下文中有exemplar标签时附加到处理时间等直方图上
+func ObserveRequest(ctx context.Context, recorder protocol.MetricsRecorder, route, method string, status int, duration time.Duration, requestSize, responseSize int64) {
+	labels := map[string]string{"route": route, "method": method, "status_class": StatusClass(status)}
+	recorder.AddCounter(ctx, httpRequestsTotalName, 1, labels)
+	recorder.ObserveHistogram(ctx, httpRequestDurationName, duration.Seconds(), labels)
+	recorder.ObserveHistogram(ctx, httpRequestSizeName, float64(requestSize), labels)
+	recorder.ObserveHistogram(ctx, httpResponseSizeName, float64(responseSize), labels)
+}
+
+// StatusAborted 处理中连接被中断、没有应答时记录的状态码
+const StatusAborted = 0
+
+// StatusClassAborted 连接被中断的请求的 status_class，和5xx一样视为错误
+const StatusClassAborted = "aborted"
+
+// StatusClass 把状态码归类为 1xx/2xx/3xx/4xx/5xx，连接被中断时为aborted
+func StatusClass(status int) string {
+	if status == StatusAborted {
+		return StatusClassAborted
+	}
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/protocol"
+)
+
+// NopRecorder 不记录任何指标的 MetricsRecorder
+type NopRecorder struct{}
+
+var _ protocol.MetricsRecorder = NopRecorder{}
+
+func (NopRecorder) AddCounter(context.Context, string, float64, map[string]string)       {}
+func (NopRecorder) SetGauge(context.Context, string, float64, map[string]string)         {}
+func (NopRecorder) AddGauge(context.Context, string, float64, map[string]string)         {}
+func (NopRecorder) ObserveHistogram(context.Context, string, float64, map[string]string) {}
+
+// MemoryRecorder 把指标保存在内存中的 MetricsRecorder，用于在测试中确认记录的指标
+type MemoryRecorder struct {
+	mu           sync.Mutex
+	counters     map[string]float64
+	gauges       map[string]float64
+	observations map[string][]float64
+}
+
+var _ protocol.MetricsRecorder = (*MemoryRecorder)(nil)
+
+// NewMemoryRecorder 生成内存中的 MetricsRecorder
+func NewMemoryRecorder() *MemoryRecorder {
+	m := &MemoryRecorder{}
+	m.Reset()
+	return m
+}
+
+func (m *MemoryRecorder) AddCounter(_ context.Context, name string, value float64, labels map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[seriesKey(name, labels)] += value
+}
+
+func (m *MemoryRecorder) SetGauge(_ context.Context, name string, value float64, labels map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gauges[seriesKey(name, labels)] = value
+}
+
+func (m *MemoryRecorder) AddGauge(_ context.Context, name string, value float64, labels map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gauges[seriesKey(name, labels)] += value
+}
+
+func (m *MemoryRecorder) ObserveHistogram(_ context.Context, name string, value float64, labels map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := seriesKey(name, labels)
+	m.observations[key] = append(m.observations[key], value)
+}
+
+// Counter 计数器的当前值
+func (m *MemoryRecorder) Counter(name string, labels map[string]string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counters[seriesKey(name, labels)]
+}
+
+// Gauge 仪表盘的当前值
+func (m *MemoryRecorder) Gauge(name string, labels map[string]string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.gauges[seriesKey(name, labels)]
+}
+
+// Observations 直方图记录的所有观测值
+func (m *MemoryRecorder) Observations(name string, labels map[string]string) []float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]float64(nil), m.observations[seriesKey(name, labels)]...)
+}
+
+// Reset 清除所有记录
+func (m *MemoryRecorder) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters = map[string]float64{}
+	m.gauges = map[string]float64{}
+	m.observations = map[string][]float64{}
+}
+
+// seriesKey 指标名和按键排序的标签，如 name{a="1",b="2"}
+func seriesKey(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+`"`+v+`"`)
+	}
+	sort.Strings(pairs)
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/auth"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 直方图bucket的布局
+const (
+	LayoutLinear      = "linear"      // 从start开始，每个bucket增加width
+	LayoutExponential = "exponential" // 从start开始，每个bucket乘以factor
+	LayoutExplicit    = "explicit"    // 直接指定各bucket的上限
+)
+
+// 原生直方图的默认设定
+const (
+	defaultNativeBucketFactor     = 1.1
+	defaultNativeMaxBucketNumber  = 160
+	defaultNativeMinResetDuration = time.Hour
+)
+
+// Options 指标的配置
+type Options struct {
+	Collectors  CollectorOptions            `mapstructure:"collectors"`  // 运行时相关指标的开关
+	Histograms  map[string]HistogramOptions `mapstructure:"histograms"`  // 按指标名设定直方图，未设定的指标使用默认bucket
+	Push        PushOptions                 `mapstructure:"push"`        // 推送到Pushgateway
+	OTLP        OTLPOptions                 `mapstructure:"otlp"`        // 通过OTLP导出到OpenTelemetry Collector
+	StatsD      StatsDOptions               `mapstructure:"statsd"`      // 输出到StatsD/DogStatsD代理
+	SLO         SLOOptions                  `mapstructure:"slo"`         // 在进程内计算SLO的错误预算和燃烧率
+	Auth        auth.Options                `mapstructure:"auth"`        // /metrics 的认证
+	Cardinality CardinalityOptions          `mapstructure:"cardinality"` // 各指标标签组合数的上限
+}
+
+// HistogramOptions 单个直方图的配置
+type HistogramOptions struct {
+	Layout  string    `mapstructure:"layout"`  // bucket的布局：linear/exponential/explicit，为空时使用默认bucket
+	Start   float64   `mapstructure:"start"`   // linear/exponential：第一个bucket的上限
+	Width   float64   `mapstructure:"width"`   // linear：bucket的间隔
+	Factor  float64   `mapstructure:"factor"`  // exponential：bucket的倍数
+	Count   int       `mapstructure:"count"`   // linear/exponential：bucket的个数
+	Buckets []float64 `mapstructure:"buckets"` // explicit：各bucket的上限，需从小到大排列
+
+	// 原生（稀疏）直方图，Prometheus 以 protobuf 格式抓取时才能得到。启用后传统的bucket仍然保留
+	Native                 bool          `mapstructure:"native"`                 // 是否启用原生直方图
+	NativeBucketFactor     float64       `mapstructure:"nativebucketfactor"`     // 相邻bucket的最大倍数，越接近1精度越高，默认1.1
+	NativeMaxBucketNumber  uint32        `mapstructure:"nativemaxbucketnumber"`  // bucket的最大个数，超过后降低精度，默认160
+	NativeMinResetDuration time.Duration `mapstructure:"nativeminresetduration"` // bucket超过最大个数时，距上次重置超过该时间才会重置，默认1小时
+}
+
+// 当前生效的指标配置
+var options Options
+
+// validate 检查各直方图的配置
+func (o Options) validate() error {
+	for name, h := range o.Histograms {
+		if _, err := h.buckets(nil); err != nil {
+			return fmt.Errorf("histogram %s: %w", name, err)
+		}
+	}
+	if err := o.Auth.Validate(); err != nil {
+		return fmt.Errorf("auth: %w", err)
+	}
+	return nil
+}
+
+// buckets 按布局生成bucket，未指定布局时返回默认bucket
+func (h HistogramOptions) buckets(defaults []float64) ([]float64, error) {
+	switch h.Layout {
+	case "":
+		return defaults, nil
+	case LayoutLinear:
+		if h.Width <= 0 || h.Count < 1 {
+			return nil, fmt.Errorf("linear buckets need width > 0 and count >= 1")
+		}
+		return prometheus.LinearBuckets(h.Start, h.Width, h.Count), nil
+	case LayoutExponential:
+		if h.Start <= 0 || h.Factor <= 1 || h.Count < 1 {
+			return nil, fmt.Errorf("exponential buckets need start > 0, factor > 1 and count >= 1")
+		}
+		return prometheus.ExponentialBuckets(h.Start, h.Factor, h.Count), nil
+	case LayoutExplicit:
+		if len(h.Buckets) == 0 {
+			return nil, fmt.Errorf("explicit buckets are empty")
+		}
+		// 有重复的上限时 prometheus.NewHistogram 会panic
+		for i := 1; i < len(h.Buckets); i++ {
+			if h.Buckets[i] <= h.Buckets[i-1] {
+				return nil, fmt.Errorf("explicit buckets must be in strictly increasing order")
+			}
+		}
+		return h.Buckets, nil
+	default:
+		return nil, fmt.Errorf("bucket layout %q not supported", h.Layout)
+	}
+}
+
+// bucketsFor 按配置取得直方图的bucket，未设定时使用默认bucket
+func bucketsFor(name string, defaultBuckets []float64) []float64 {
+	h, ok := options.Histograms[name]
+	if !ok {
+		return defaultBuckets
+	}
+	// 配置在加载时已检查过
+	buckets, _ := h.buckets(defaultBuckets)
+	return buckets
+}
+
+// histogramOpts 生成直方图的设定，按配置替换默认的bucket并启用原生直方图
+func histogramOpts(name, help string, defaultBuckets []float64) prometheus.HistogramOpts {
+	opts := prometheus.HistogramOpts{
+		Name:    name,
+		Help:    help,
+		Buckets: bucketsFor(name, defaultBuckets),
+	}
+
+	if h := options.Histograms[name]; h.Native {
+		opts.NativeHistogramBucketFactor = h.NativeBucketFactor
+		if opts.NativeHistogramBucketFactor <= 1 {
+			opts.NativeHistogramBucketFactor = defaultNativeBucketFactor
+		}
+		opts.NativeHistogramMaxBucketNumber = h.NativeMaxBucketNumber
+		if opts.NativeHistogramMaxBucketNumber == 0 {
+			opts.NativeHistogramMaxBucketNumber = defaultNativeMaxBucketNumber
+		}
+		opts.NativeHistogramMinResetDuration = h.NativeMinResetDuration
+		if opts.NativeHistogramMinResetDuration <= 0 {
+			opts.NativeHistogramMinResetDuration = defaultNativeMinResetDuration
+		}
+	}
+	return opts
+}
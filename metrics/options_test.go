@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnit_histogramBuckets(t *testing.T) {
+	assert := assert.New(t)
+
+	defaults := []float64{1, 2}
+	cases := []struct {
+		opts    HistogramOptions
+		buckets []float64
+		err     bool
+	}{
+		{HistogramOptions{}, defaults, false},
+		{HistogramOptions{Layout: LayoutLinear, Start: 0.5, Width: 0.5, Count: 3}, []float64{0.5, 1, 1.5}, false},
+		{HistogramOptions{Layout: LayoutExponential, Start: 1, Factor: 2, Count: 4}, []float64{1, 2, 4, 8}, false},
+		{HistogramOptions{Layout: LayoutExplicit, Buckets: []float64{0.1, 1, 10}}, []float64{0.1, 1, 10}, false},
+		{HistogramOptions{Layout: LayoutLinear, Start: 0, Width: 0, Count: 3}, nil, true},
+		{HistogramOptions{Layout: LayoutExponential, Start: 1, Factor: 1, Count: 3}, nil, true},
+		{HistogramOptions{Layout: LayoutExplicit, Buckets: []float64{1, 0.5}}, nil, true},
+		{HistogramOptions{Layout: LayoutExplicit, Buckets: []float64{0.1, 0.1, 1}}, nil, true},
+		{HistogramOptions{Layout: "unknown"}, nil, true},
+	}
+	for _, c := range cases {
+		buckets, err := c.opts.buckets(defaults)
+		if c.err {
+			assert.Error(err, c.opts.Layout)
+			continue
+		}
+		assert.NoError(err)
+		assert.Equal(c.buckets, buckets)
+	}
+}
+
+func TestUnit_histogramOptsNative(t *testing.T) {
+	assert := assert.New(t)
+
+	saved := options
+	defer func() { options = saved }()
+	options = Options{Histograms: map[string]HistogramOptions{
+		"test_seconds": {Layout: LayoutExplicit, Buckets: []float64{1, 5}, Native: true},
+	}}
+
+	opts := histogramOpts("test_seconds", "test", []float64{1})
+	assert.Equal([]float64{1, 5}, opts.Buckets)
+	assert.Equal(defaultNativeBucketFactor, opts.NativeHistogramBucketFactor)
+	assert.Equal(uint32(defaultNativeMaxBucketNumber), opts.NativeHistogramMaxBucketNumber)
+
+	// 未设定的指标使用默认值，不启用原生直方图
+	opts = histogramOpts("other_seconds", "test", []float64{1})
+	assert.Equal([]float64{1}, opts.Buckets)
+	assert.Zero(opts.NativeHistogramBucketFactor)
+}
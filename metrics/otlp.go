@@ -0,0 +1,252 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/environment"
+	"github.com/kabacloud/cloudnativehomework4-module10/protocol"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// OTLP的传输协议
+const (
+	OTLPProtocolHTTP = "http" // OTLP/HTTP，默认端口4318
+	OTLPProtocolGRPC = "grpc" // OTLP/gRPC，默认端口4317
+)
+
+// 聚合的时间性
+const (
+	TemporalityCumulative = "cumulative" // 累计值，和Prometheus相同
+	TemporalityDelta      = "delta"      // 每个导出间隔内的增量
+)
+
+const (
+	defaultOTLPServiceName = "httpserver"
+	otlpScope              = "github.com/kabacloud/cloudnativehomework4-module10/metrics"
+)
+
+// OTLPOptions 通过OTLP导出指标的配置，和Prometheus的 /metrics 同时有效
+type OTLPOptions struct {
+	Protocol    string            `mapstructure:"protocol"`    // 传输协议：http/grpc，为空时不导出
+	Endpoint    string            `mapstructure:"endpoint"`    // OpenTelemetry Collector的地址，如 otel-collector:4318，为空时使用SDK的默认值
+	Insecure    bool              `mapstructure:"insecure"`    // 不使用TLS
+	Headers     map[string]string `mapstructure:"headers"`     // 追加的请求头，如认证信息
+	Interval    time.Duration     `mapstructure:"interval"`    // 导出间隔，默认1分钟
+	Timeout     time.Duration     `mapstructure:"timeout"`     // 单次导出的超时时间，默认10秒
+	Temporality string            `mapstructure:"temporality"` // 聚合的时间性：cumulative/delta，默认为cumulative，注册表中的其他指标总是累计值
+	ServiceName string            `mapstructure:"service"`     // 资源属性service.name，默认为 httpserver
+	Attributes  map[string]string `mapstructure:"attributes"`  // 追加的资源属性
+}
+
+// otelInstruments 和Prometheus指标对应的OpenTelemetry指标
+type otelInstruments struct {
+	requests      metric.Int64Counter
+	duration      metric.Float64Histogram
+	requestSize   metric.Int64Histogram
+	responseSize  metric.Int64Histogram
+	inFlight      metric.Int64UpDownCounter
+	sleepDuration metric.Float64Histogram
+}
+
+var _ protocol.MetricsRecorder = (*otelInstruments)(nil)
+
+// OTLPExporter 定期通过OTLP导出指标，作为 MetricsRecorder 和其他后端一起接收记录的指标
+type OTLPExporter struct {
+	provider *sdkmetric.MeterProvider
+	*otelInstruments
+}
+
+// StartOTLP 开始通过OTLP导出请求和延时的指标，注册表中的其他指标也一并导出。
+// 需在 LoadRegistryWithOptions 之后调用，以使用相同的bucket配置
+func StartOTLP(ctx context.Context, opts OTLPOptions) (*OTLPExporter, error) {
+	exporter, err := newOTLPExporter(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceName := opts.ServiceName
+	if serviceName == "" {
+		serviceName = defaultOTLPServiceName
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, environment.ResourceAttributes(serviceName, opts.Attributes)...))
+	if err != nil {
+		return nil, err
+	}
+
+	var readerOpts []sdkmetric.PeriodicReaderOption
+	if opts.Interval > 0 {
+		readerOpts = append(readerOpts, sdkmetric.WithInterval(opts.Interval))
+	}
+	if opts.Timeout > 0 {
+		readerOpts = append(readerOpts, sdkmetric.WithTimeout(opts.Timeout))
+	}
+	if registry != nil {
+		readerOpts = append(readerOpts, sdkmetric.WithProducer(registryProducer{gatherer: registry}))
+	}
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(res),
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, readerOpts...)),
+	)
+
+	instruments, err := newOtelInstruments(provider.Meter(otlpScope))
+	if err != nil {
+		_ = provider.Shutdown(ctx)
+		return nil, err
+	}
+	return &OTLPExporter{provider: provider, otelInstruments: instruments}, nil
+}
+
+// Shutdown 导出剩余的指标后停止，之后记录的指标被忽略
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	return e.provider.Shutdown(ctx)
+}
+
+// newOTLPExporter 按传输协议生成导出器
+func newOTLPExporter(ctx context.Context, opts OTLPOptions) (sdkmetric.Exporter, error) {
+	var selector sdkmetric.TemporalitySelector
+	switch opts.Temporality {
+	case "", TemporalityCumulative:
+		selector = sdkmetric.DefaultTemporalitySelector
+	case TemporalityDelta:
+		selector = deltaTemporality
+	default:
+		return nil, fmt.Errorf("otlp temporality %q not supported", opts.Temporality)
+	}
+
+	switch opts.Protocol {
+	case OTLPProtocolHTTP:
+		httpOpts := []otlpmetrichttp.Option{otlpmetrichttp.WithTemporalitySelector(selector)}
+		if opts.Endpoint != "" {
+			httpOpts = append(httpOpts, otlpmetrichttp.WithEndpoint(opts.Endpoint))
+		}
+		if opts.Insecure {
+			httpOpts = append(httpOpts, otlpmetrichttp.WithInsecure())
+		}
+		if len(opts.Headers) > 0 {
+			httpOpts = append(httpOpts, otlpmetrichttp.WithHeaders(opts.Headers))
+		}
+		if opts.Timeout > 0 {
+			httpOpts = append(httpOpts, otlpmetrichttp.WithTimeout(opts.Timeout))
+		}
+		return otlpmetrichttp.New(ctx, httpOpts...)
+	case OTLPProtocolGRPC:
+		grpcOpts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithTemporalitySelector(selector)}
+		if opts.Endpoint != "" {
+			grpcOpts = append(grpcOpts, otlpmetricgrpc.WithEndpoint(opts.Endpoint))
+		}
+		if opts.Insecure {
+			grpcOpts = append(grpcOpts, otlpmetricgrpc.WithInsecure())
+		}
+		if len(opts.Headers) > 0 {
+			grpcOpts = append(grpcOpts, otlpmetricgrpc.WithHeaders(opts.Headers))
+		}
+		if opts.Timeout > 0 {
+			grpcOpts = append(grpcOpts, otlpmetricgrpc.WithTimeout(opts.Timeout))
+		}
+		return otlpmetricgrpc.New(ctx, grpcOpts...)
+	default:
+		return nil, fmt.Errorf("otlp protocol %q not supported", opts.Protocol)
+	}
+}
+
+// deltaTemporality 计数器和直方图使用增量，UpDownCounter仍使用累计值
+func deltaTemporality(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+	switch kind {
+	case sdkmetric.InstrumentKindUpDownCounter, sdkmetric.InstrumentKindObservableUpDownCounter:
+		return metricdata.CumulativeTemporality
+	default:
+		return metricdata.DeltaTemporality
+	}
+}
+
+// newOtelInstruments 生成和Prometheus指标对应的OpenTelemetry指标，直方图使用相同的bucket
+func newOtelInstruments(meter metric.Meter) (*otelInstruments, error) {
+	var (
+		i   otelInstruments
+		err error
+	)
+	if i.requests, err = meter.Int64Counter("httpserver.http.requests",
+		metric.WithDescription("The total number of handled HTTP requests."),
+		metric.WithUnit("{request}")); err != nil {
+		return nil, err
+	}
+	if i.duration, err = meter.Float64Histogram("httpserver.http.request.duration",
+		metric.WithDescription("A histogram of the HTTP request durations in seconds."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(bucketsFor(httpRequestDurationName, durationBuckets)...)); err != nil {
+		return nil, err
+	}
+	if i.requestSize, err = meter.Int64Histogram("httpserver.http.request.size",
+		metric.WithDescription("A histogram of the HTTP request body sizes in bytes."),
+		metric.WithUnit("By"),
+		metric.WithExplicitBucketBoundaries(bucketsFor(httpRequestSizeName, sizeBuckets)...)); err != nil {
+		return nil, err
+	}
+	if i.responseSize, err = meter.Int64Histogram("httpserver.http.response.size",
+		metric.WithDescription("A histogram of the HTTP response body sizes in bytes."),
+		metric.WithUnit("By"),
+		metric.WithExplicitBucketBoundaries(bucketsFor(httpResponseSizeName, sizeBuckets)...)); err != nil {
+		return nil, err
+	}
+	if i.inFlight, err = meter.Int64UpDownCounter("httpserver.http.requests.in_flight",
+		metric.WithDescription("The number of HTTP requests currently being served."),
+		metric.WithUnit("{request}")); err != nil {
+		return nil, err
+	}
+	if i.sleepDuration, err = meter.Float64Histogram("httpserver.sleep.duration",
+		metric.WithDescription("A histogram of the HTTP request durations in seconds."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(bucketsFor(SleepDurationName, sleepBuckets)...)); err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// AddCounter 记录处理完的请求数，其他指标只通过Prometheus输出
+func (i *otelInstruments) AddCounter(ctx context.Context, name string, value float64, labels map[string]string) {
+	if name == httpRequestsTotalName {
+		i.requests.Add(ctx, int64(value), otelAttributes(labels))
+	}
+}
+
+// SetGauge 没有对应的OpenTelemetry指标
+func (i *otelInstruments) SetGauge(context.Context, string, float64, map[string]string) {}
+
+// AddGauge 和Prometheus的in-flight指标一起增减
+func (i *otelInstruments) AddGauge(ctx context.Context, name string, value float64, labels map[string]string) {
+	if name == httpInFlightName {
+		i.inFlight.Add(ctx, int64(value), otelAttributes(labels))
+	}
+}
+
+// ObserveHistogram 记录请求的处理时间、大小和延时
+func (i *otelInstruments) ObserveHistogram(ctx context.Context, name string, value float64, labels map[string]string) {
+	switch name {
+	case httpRequestDurationName:
+		i.duration.Record(ctx, value, otelAttributes(labels))
+	case httpRequestSizeName:
+		i.requestSize.Record(ctx, int64(value), otelAttributes(labels))
+	case httpResponseSizeName:
+		i.responseSize.Record(ctx, int64(value), otelAttributes(labels))
+	case SleepDurationName:
+		i.sleepDuration.Record(ctx, value, otelAttributes(labels))
+	}
+}
+
+// otelAttributes 把标签按键排序转换为属性
+func otelAttributes(labels map[string]string) metric.MeasurementOption {
+	attrs := make([]attribute.KeyValue, 0, len(labels))
+	for _, k := range labelNames(labels) {
+		attrs = append(attrs, attribute.String(k, labels[k]))
+	}
+	return metric.WithAttributes(attrs...)
+}
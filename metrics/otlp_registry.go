@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/environment"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+const otlpRegistryScope = otlpScope + "/prometheus"
+
+// otelInstrumentNames 已作为OpenTelemetry指标（httpserver.http.* 等）导出的Prometheus指标，从注册表导出时跳过
+var otelInstrumentNames = map[string]bool{
+	httpRequestsTotalName:   true,
+	httpRequestDurationName: true,
+	httpRequestSizeName:     true,
+	httpResponseSizeName:    true,
+	httpInFlightName:        true,
+	SleepDurationName:       true,
+}
+
+// registryProducer 把注册表中的其他指标（构建信息、生命周期、SLO、归入other的观测值、进程和Go运行时、通过 MetricsRecorder 记录的指标等）
+// 在每次导出时转换为OTLP的指标。指标名和Prometheus相同，不附带exemplar；
+// 计数器、直方图和摘要总是以从进程启动开始的累计值导出，和 temporality 的设定无关
+type registryProducer struct {
+	gatherer prometheus.Gatherer
+}
+
+func (p registryProducer) Produce(context.Context) ([]metricdata.ScopeMetrics, error) {
+	families, err := p.gatherer.Gather()
+	now := time.Now()
+	metrics := make([]metricdata.Metrics, 0, len(families))
+	for _, f := range families {
+		if otelInstrumentNames[f.GetName()] {
+			continue
+		}
+		if m, ok := convertFamily(f, environment.StartTime, now); ok {
+			metrics = append(metrics, m)
+		}
+	}
+	return []metricdata.ScopeMetrics{{Scope: instrumentation.Scope{Name: otlpRegistryScope}, Metrics: metrics}}, err
+}
+
+// convertFamily 把Prometheus的指标转换为OTLP的指标，不支持的类型（gauge histogram）返回false
+func convertFamily(f *dto.MetricFamily, start, now time.Time) (metricdata.Metrics, bool) {
+	m := metricdata.Metrics{Name: f.GetName(), Description: f.GetHelp()}
+	switch f.GetType() {
+	case dto.MetricType_COUNTER:
+		sum := metricdata.Sum[float64]{Temporality: metricdata.CumulativeTemporality, IsMonotonic: true}
+		for _, pm := range f.GetMetric() {
+			sum.DataPoints = append(sum.DataPoints, metricdata.DataPoint[float64]{
+				Attributes: promAttributes(pm), StartTime: start, Time: now, Value: pm.GetCounter().GetValue(),
+			})
+		}
+		m.Data = sum
+	case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+		var gauge metricdata.Gauge[float64]
+		for _, pm := range f.GetMetric() {
+			value := pm.GetGauge().GetValue()
+			if f.GetType() == dto.MetricType_UNTYPED {
+				value = pm.GetUntyped().GetValue()
+			}
+			gauge.DataPoints = append(gauge.DataPoints, metricdata.DataPoint[float64]{
+				Attributes: promAttributes(pm), Time: now, Value: value,
+			})
+		}
+		m.Data = gauge
+	case dto.MetricType_HISTOGRAM:
+		hist := metricdata.Histogram[float64]{Temporality: metricdata.CumulativeTemporality}
+		for _, pm := range f.GetMetric() {
+			h := pm.GetHistogram()
+			dp := metricdata.HistogramDataPoint[float64]{
+				Attributes: promAttributes(pm), StartTime: start, Time: now, Count: h.GetSampleCount(), Sum: h.GetSampleSum(),
+			}
+			// Prometheus的bucket是累计的，OTLP的是各区间的计数，+Inf的bucket为最后一个区间
+			var prev uint64
+			for _, b := range h.GetBucket() {
+				if math.IsInf(b.GetUpperBound(), 1) {
+					continue
+				}
+				dp.Bounds = append(dp.Bounds, b.GetUpperBound())
+				dp.BucketCounts = append(dp.BucketCounts, b.GetCumulativeCount()-prev)
+				prev = b.GetCumulativeCount()
+			}
+			dp.BucketCounts = append(dp.BucketCounts, h.GetSampleCount()-prev)
+			hist.DataPoints = append(hist.DataPoints, dp)
+		}
+		m.Data = hist
+	case dto.MetricType_SUMMARY:
+		var summary metricdata.Summary
+		for _, pm := range f.GetMetric() {
+			s := pm.GetSummary()
+			dp := metricdata.SummaryDataPoint{
+				Attributes: promAttributes(pm), StartTime: start, Time: now, Count: s.GetSampleCount(), Sum: s.GetSampleSum(),
+			}
+			for _, q := range s.GetQuantile() {
+				dp.QuantileValues = append(dp.QuantileValues, metricdata.QuantileValue{Quantile: q.GetQuantile(), Value: q.GetValue()})
+			}
+			summary.DataPoints = append(summary.DataPoints, dp)
+		}
+		m.Data = summary
+	default:
+		return m, false
+	}
+	return m, true
+}
+
+// promAttributes 把Prometheus的标签转换为属性
+func promAttributes(pm *dto.Metric) attribute.Set {
+	attrs := make([]attribute.KeyValue, 0, len(pm.GetLabel()))
+	for _, l := range pm.GetLabel() {
+		attrs = append(attrs, attribute.String(l.GetName(), l.GetValue()))
+	}
+	return attribute.NewSet(attrs...)
+}
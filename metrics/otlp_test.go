@@ -0,0 +1,151 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestUnit_otlpInstruments(t *testing.T) {
+	assert := assert.New(t)
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	defer provider.Shutdown(context.Background())
+
+	i, err := newOtelInstruments(provider.Meter(otlpScope))
+	assert.NoError(err)
+
+	done := RequestStarted(context.Background(), i, "/info", http.MethodGet)
+	ObserveRequest(context.Background(), i, "/info", http.MethodGet, http.StatusOK, 300*time.Millisecond, 10, 2000)
+	done()
+	i.ObserveHistogram(context.Background(), SleepDurationName, 1.2, nil)
+	// 没有对应的OpenTelemetry指标时被忽略
+	i.AddCounter(context.Background(), "jobs_total", 1, nil)
+
+	var rm metricdata.ResourceMetrics
+	assert.NoError(reader.Collect(context.Background(), &rm))
+	got := map[string]metricdata.Aggregation{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			got[m.Name] = m.Data
+		}
+	}
+
+	requests := got["httpserver.http.requests"].(metricdata.Sum[int64])
+	assert.Equal(int64(1), requests.DataPoints[0].Value)
+	route, _ := requests.DataPoints[0].Attributes.Value("route")
+	assert.Equal("/info", route.AsString())
+	class, _ := requests.DataPoints[0].Attributes.Value("status_class")
+	assert.Equal("2xx", class.AsString())
+
+	duration := got["httpserver.http.request.duration"].(metricdata.Histogram[float64])
+	assert.Equal(durationBuckets, duration.DataPoints[0].Bounds)
+	assert.Equal(uint64(1), duration.DataPoints[0].Count)
+
+	inFlight := got["httpserver.http.requests.in_flight"].(metricdata.Sum[int64])
+	assert.Equal(int64(0), inFlight.DataPoints[0].Value)
+
+	sleep := got["httpserver.sleep.duration"].(metricdata.Histogram[float64])
+	assert.Equal(sleepBuckets, sleep.DataPoints[0].Bounds)
+	assert.Len(got, 6)
+}
+
+func TestUnit_otlpRegistry(t *testing.T) {
+	assert := assert.New(t)
+
+	savedDropped, savedLifecycle := droppedObservations, lifecycleState
+	defer func() { droppedObservations, lifecycleState = savedDropped, savedLifecycle }()
+	r := prometheus.NewRegistry()
+	registerRuntime(r, CollectorOptions{Go: true})
+	registerCardinality(r)
+	droppedObservations.WithLabelValues(httpRequestsTotalName).Inc()
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{Name: httpRequestsTotalName, Help: "test"}, httpLabels)
+	requests.WithLabelValues("/info", "GET", "2xx").Inc()
+	r.MustRegister(requests)
+	tracker, err := NewSLOTracker(SLOOptions{Objectives: []SLOObjective{
+		{Name: "availability", Type: SLOAvailability, Target: 0.999},
+	}})
+	assert.NoError(err)
+	r.MustRegister(tracker)
+	jobs := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "job_duration_seconds", Help: "test", Buckets: []float64{1, 2}})
+	r.MustRegister(jobs)
+	for _, v := range []float64{0.5, 1.5, 3} {
+		jobs.Observe(v)
+	}
+
+	scopes, err := registryProducer{gatherer: r}.Produce(context.Background())
+	assert.NoError(err)
+	got := map[string]metricdata.Aggregation{}
+	for _, m := range scopes[0].Metrics {
+		got[m.Name] = m.Data
+	}
+
+	// 注册表中的其他指标按原来的名称导出
+	for _, name := range []string{
+		buildInfoName, uptimeName, lifecycleStateName, droppedObservationsName,
+		sloTargetName, sloSLIName, sloRemainingName, sloBurnRateName, sloBurnAlertName,
+		"go_goroutines", "go_gc_duration_seconds", "job_duration_seconds",
+	} {
+		assert.Contains(got, name)
+	}
+	// 请求和延时已作为OpenTelemetry指标导出
+	for name := range otelInstrumentNames {
+		assert.NotContains(got, name)
+	}
+
+	dropped := got[droppedObservationsName].(metricdata.Sum[float64])
+	assert.True(dropped.IsMonotonic)
+	assert.Equal(metricdata.CumulativeTemporality, dropped.Temporality)
+	assert.IsType(metricdata.Gauge[float64]{}, got[lifecycleStateName])
+	assert.IsType(metricdata.Summary{}, got["go_gc_duration_seconds"])
+	hist := got["job_duration_seconds"].(metricdata.Histogram[float64])
+	assert.Equal([]float64{1, 2}, hist.DataPoints[0].Bounds)
+	assert.Equal([]uint64{1, 1, 1}, hist.DataPoints[0].BucketCounts)
+	assert.Equal(5.0, hist.DataPoints[0].Sum)
+}
+
+func TestUnit_otlpTemporality(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(metricdata.DeltaTemporality, deltaTemporality(sdkmetric.InstrumentKindCounter))
+	assert.Equal(metricdata.DeltaTemporality, deltaTemporality(sdkmetric.InstrumentKindHistogram))
+	assert.Equal(metricdata.CumulativeTemporality, deltaTemporality(sdkmetric.InstrumentKindUpDownCounter))
+
+	_, err := newOTLPExporter(context.Background(), OTLPOptions{Protocol: "udp"})
+	assert.Error(err)
+	_, err = newOTLPExporter(context.Background(), OTLPOptions{Protocol: OTLPProtocolHTTP, Temporality: "sometimes"})
+	assert.Error(err)
+}
+
+func TestUnit_otlpExportOnShutdown(t *testing.T) {
+	assert := assert.New(t)
+
+	stub := &pushgatewayStub{}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	e, err := StartOTLP(context.Background(), OTLPOptions{
+		Protocol: OTLPProtocolHTTP,
+		Endpoint: srv.Listener.Addr().String(),
+		Insecure: true,
+		Interval: time.Hour,
+		Headers:  map[string]string{"X-Scope-OrgID": "tenant"},
+	})
+	assert.NoError(err)
+	ObserveRequest(context.Background(), e, "/info", http.MethodGet, http.StatusOK, time.Second, 0, 0)
+
+	assert.NoError(e.Shutdown(context.Background()))
+	// 停止后记录的指标被忽略
+	ObserveRequest(context.Background(), e, "/info", http.MethodGet, http.StatusOK, time.Second, 0, 0)
+	assert.Equal(1, stub.count())
+	assert.Equal("/v1/metrics", stub.requests[0].URL.Path)
+	assert.Equal("tenant", stub.requests[0].Header.Get("X-Scope-OrgID"))
+}
@@ -0,0 +1,185 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/protocol"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// SleepDurationName 延时的直方图
+const SleepDurationName = "httpserver_sleep_duration_seconds"
+
+// PrometheusRecorder 把指标记录到Prometheus注册表。
+// 指标在第一次记录时以该次标签的键生成并注册，之后标签的键不一致的记录会被忽略；直方图的bucket可通过配置设定。
+// 标签组合数超过配置的上限时归入other。
+// 使用 LoadRegistry 的注册表时，HTTP请求和延时等内置指标使用已注册的定义。
+// 指标名不合法、和已注册的其他定义冲突等注册失败时不再记录该指标，错误通过 OnError 和 Err 通知；
+// 计数器增加负数时忽略该次记录并同样通知。
+type PrometheusRecorder struct {
+	// 指标注册失败（每个指标名只调用一次）或记录的值不合法时调用
+	OnError func(name string, err error)
+
+	registerer prometheus.Registerer
+
+	mu         sync.Mutex
+	counters   map[string]*prometheus.CounterVec // 注册失败的指标为nil
+	gauges     map[string]*prometheus.GaugeVec
+	histograms map[string]*prometheus.HistogramVec
+	lastErr    error
+}
+
+var _ protocol.MetricsRecorder = (*PrometheusRecorder)(nil)
+
+// NewPrometheusRecorder 生成记录到注册表的 MetricsRecorder
+func NewPrometheusRecorder(r prometheus.Registerer) *PrometheusRecorder {
+	p := &PrometheusRecorder{
+		registerer: r,
+		counters:   map[string]*prometheus.CounterVec{},
+		gauges:     map[string]*prometheus.GaugeVec{},
+		histograms: map[string]*prometheus.HistogramVec{},
+	}
+	if registry != nil && r == prometheus.Registerer(registry) {
+		p.counters[httpRequestsTotalName] = httpRequestsTotal
+		p.gauges[httpInFlightName] = httpInFlight
+		p.histograms[httpRequestDurationName] = httpRequestDuration
+		p.histograms[httpRequestSizeName] = httpRequestSize
+		p.histograms[httpResponseSizeName] = httpResponseSize
+		p.histograms[SleepDurationName] = httpserverSleepDurations
+	}
+	return p
+}
+
+// Err 最后一次注册或记录指标失败的错误，没有失败时为nil
+func (p *PrometheusRecorder) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lastErr
+}
+
+func (p *PrometheusRecorder) AddCounter(_ context.Context, name string, value float64, labels map[string]string) {
+	if value < 0 {
+		p.fail(name, fmt.Errorf("counter %s: negative value %v", name, value))
+		return
+	}
+
+	p.mu.Lock()
+	vec, ok := p.counters[name]
+	var err error
+	if !ok {
+		vec, err = register(p.registerer, prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help(name)}, labelNames(labels)))
+		p.counters[name] = vec
+	}
+	p.mu.Unlock()
+	if err != nil {
+		p.fail(name, err)
+	}
+	if vec == nil {
+		return
+	}
+
+	if c, err := vec.GetMetricWith(limitLabelMap(name, labels)); err == nil {
+		c.Add(value)
+	}
+}
+
+func (p *PrometheusRecorder) SetGauge(_ context.Context, name string, value float64, labels map[string]string) {
+	vec := p.gauge(name, labels)
+	if vec == nil {
+		return
+	}
+	if g, err := vec.GetMetricWith(limitLabelMap(name, labels)); err == nil {
+		g.Set(value)
+	}
+}
+
+func (p *PrometheusRecorder) AddGauge(_ context.Context, name string, value float64, labels map[string]string) {
+	vec := p.gauge(name, labels)
+	if vec == nil {
+		return
+	}
+	if g, err := vec.GetMetricWith(limitLabelMap(name, labels)); err == nil {
+		g.Add(value)
+	}
+}
+
+func (p *PrometheusRecorder) ObserveHistogram(ctx context.Context, name string, value float64, labels map[string]string) {
+	p.mu.Lock()
+	vec, ok := p.histograms[name]
+	var err error
+	if !ok {
+		vec, err = register(p.registerer, prometheus.NewHistogramVec(histogramOpts(name, help(name), prometheus.DefBuckets), labelNames(labels)))
+		p.histograms[name] = vec
+	}
+	p.mu.Unlock()
+	if err != nil {
+		p.fail(name, err)
+	}
+	if vec == nil {
+		return
+	}
+
+	if o, err := vec.GetMetricWith(limitLabelMap(name, labels)); err == nil {
+		observe(o, value, ExemplarFromContext(ctx))
+	}
+}
+
+// gauge 取得或注册gauge，注册失败时为nil
+func (p *PrometheusRecorder) gauge(name string, labels map[string]string) *prometheus.GaugeVec {
+	p.mu.Lock()
+	vec, ok := p.gauges[name]
+	var err error
+	if !ok {
+		vec, err = register(p.registerer, prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help(name)}, labelNames(labels)))
+		p.gauges[name] = vec
+	}
+	p.mu.Unlock()
+	if err != nil {
+		p.fail(name, err)
+	}
+	return vec
+}
+
+// fail 记录注册或记录失败的错误并通知
+func (p *PrometheusRecorder) fail(name string, err error) {
+	p.mu.Lock()
+	p.lastErr = err
+	p.mu.Unlock()
+	if p.OnError != nil {
+		p.OnError(name, err)
+	}
+}
+
+// register 注册指标，同名同定义的指标已注册时使用已有的指标，其他错误时返回nil和错误
+func register[T prometheus.Collector](r prometheus.Registerer, c T) (T, error) {
+	err := r.Register(c)
+	if err == nil {
+		return c, nil
+	}
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		if existing, ok := are.ExistingCollector.(T); ok {
+			return existing, nil
+		}
+	}
+	var zero T
+	return zero, fmt.Errorf("register metric: %w", err)
+}
+
+// labelNames 按名称排序的标签的键
+func labelNames(labels map[string]string) []string {
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func help(name string) string {
+	return name + " recorded through MetricsRecorder."
+}
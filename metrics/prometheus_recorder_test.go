@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnit_prometheusRecorder(t *testing.T) {
+	assert := assert.New(t)
+
+	r := prometheus.NewRegistry()
+	p := NewPrometheusRecorder(r)
+	ctx := context.Background()
+
+	p.AddCounter(ctx, "jobs_total", 2, map[string]string{"queue": "mail"})
+	p.AddCounter(ctx, "jobs_total", 1, map[string]string{"queue": "mail"})
+	// 标签的键不一致的记录被忽略
+	p.AddCounter(ctx, "jobs_total", 1, map[string]string{"topic": "mail"})
+	p.SetGauge(ctx, "workers", 4, nil)
+	p.AddGauge(ctx, "workers", -1, nil)
+	p.ObserveHistogram(ctx, "job_duration_seconds", 0.3, map[string]string{"queue": "mail"})
+
+	assert.NoError(testutil.GatherAndCompare(r, strings.NewReader(`
+# HELP jobs_total jobs_total recorded through MetricsRecorder.
+# TYPE jobs_total counter
+jobs_total{queue="mail"} 3
+# HELP workers workers recorded through MetricsRecorder.
+# TYPE workers gauge
+workers 3
+`), "jobs_total", "workers"))
+	assert.Equal(1, testutil.CollectAndCount(r, "job_duration_seconds"))
+
+	// 其他Recorder使用同一注册表时共用已注册的指标
+	NewPrometheusRecorder(r).AddCounter(ctx, "jobs_total", 1, map[string]string{"queue": "mail"})
+	assert.NoError(testutil.GatherAndCompare(r, strings.NewReader(`
+# HELP jobs_total jobs_total recorded through MetricsRecorder.
+# TYPE jobs_total counter
+jobs_total{queue="mail"} 4
+`), "jobs_total"))
+
+	// 和已注册的其他类型的指标冲突时通知错误，每个指标名只通知一次
+	var failed []string
+	p.OnError = func(name string, err error) { failed = append(failed, name) }
+	p.SetGauge(ctx, "jobs_total", 1, map[string]string{"queue": "mail"})
+	p.SetGauge(ctx, "jobs_total", 2, map[string]string{"queue": "mail"})
+	p.ObserveHistogram(ctx, "bad-name", 1, nil)
+	assert.Equal([]string{"jobs_total", "bad-name"}, failed)
+	assert.Error(p.Err())
+	assert.NoError(NewPrometheusRecorder(r).Err())
+
+	// 计数器增加负数时忽略该次记录并通知错误，不panic
+	failed = nil
+	assert.NotPanics(func() { p.AddCounter(ctx, "jobs_total", -1, map[string]string{"queue": "mail"}) })
+	assert.Equal([]string{"jobs_total"}, failed)
+	assert.Equal(4.0, testutil.ToFloat64(p.counters["jobs_total"]))
+}
+
+func TestUnit_memoryRecorder(t *testing.T) {
+	assert := assert.New(t)
+
+	m := NewMemoryRecorder()
+	ctx := context.Background()
+
+	m.AddCounter(ctx, "jobs_total", 1, map[string]string{"queue": "mail", "result": "ok"})
+	m.AddCounter(ctx, "jobs_total", 1, map[string]string{"result": "ok", "queue": "mail"})
+	m.AddGauge(ctx, "workers", 2, nil)
+	m.SetGauge(ctx, "workers", 5, nil)
+	m.ObserveHistogram(ctx, SleepDurationName, 0.5, nil)
+	m.ObserveHistogram(ctx, SleepDurationName, 1.5, nil)
+
+	assert.Equal(2.0, m.Counter("jobs_total", map[string]string{"queue": "mail", "result": "ok"}))
+	assert.Equal(0.0, m.Counter("jobs_total", map[string]string{"queue": "sms", "result": "ok"}))
+	assert.Equal(5.0, m.Gauge("workers", nil))
+	assert.Equal([]float64{0.5, 1.5}, m.Observations(SleepDurationName, nil))
+
+	m.Reset()
+	assert.Empty(m.Observations(SleepDurationName, nil))
+}
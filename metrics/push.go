@@ -0,0 +1,158 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/auth"
+	"github.com/kabacloud/cloudnativehomework4-module10/environment"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// 推送方式
+const (
+	PushMethodAdd  = "add"  // POST：只替换同名的指标
+	PushMethodPush = "push" // PUT：替换同一分组下的所有指标
+)
+
+const (
+	defaultPushJob     = "httpserver"
+	defaultPushTimeout = 10 * time.Second
+)
+
+// PushOptions 推送到Pushgateway的配置，用于抓取前就可能退出的批处理任务
+type PushOptions struct {
+	URL      string            `mapstructure:"url"`      // Pushgateway的地址，为空时不推送
+	Job      string            `mapstructure:"job"`      // job名，默认为 httpserver
+	Method   string            `mapstructure:"method"`   // 推送方式：add/push，默认为add
+	Interval time.Duration     `mapstructure:"interval"` // 定期推送的间隔，为0时只在退出时推送
+	Timeout  time.Duration     `mapstructure:"timeout"`  // 单次推送的超时时间
+	Grouping map[string]string `mapstructure:"grouping"` // 追加的分组键，默认有 instance（主机名）和 env（执行环境）
+	Username string            `mapstructure:"username"` // Basic认证的用户名
+	Password string            `mapstructure:"password"` // Basic认证的密码
+	// 保存Basic认证密码的文件，优先于password
+	PasswordFile string `mapstructure:"passwordfile"`
+}
+
+// Pusher 定期以及在退出时把注册表中的指标推送到Pushgateway
+type Pusher struct {
+	pusher   *push.Pusher
+	method   string
+	interval time.Duration
+	timeout  time.Duration
+
+	quit     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+	errMu    sync.Mutex
+	lastErr  error // 定期推送最后一次的错误
+}
+
+// NewPusher 生成推送器，设定了推送间隔时开始定期推送。推送方式不支持、读取密码文件失败时为错误
+func NewPusher(g prometheus.Gatherer, opts PushOptions) (*Pusher, error) {
+	switch opts.Method {
+	case "", PushMethodAdd, PushMethodPush:
+	default:
+		return nil, fmt.Errorf("push method %q not supported", opts.Method)
+	}
+	if opts.PasswordFile != "" {
+		password, err := auth.ReadSecret(opts.PasswordFile)
+		if err != nil {
+			return nil, err
+		}
+		opts.Password = password
+	}
+	if (opts.Username == "") != (opts.Password == "") {
+		return nil, fmt.Errorf("push username and password must be set together")
+	}
+
+	job := opts.Job
+	if job == "" {
+		job = defaultPushJob
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultPushTimeout
+	}
+
+	pusher := push.New(opts.URL, job).Gatherer(g).Client(&http.Client{Timeout: timeout})
+	grouping := map[string]string{
+		"instance": environment.Hostname,
+		"env":      environment.ExecENV,
+	}
+	for k, v := range opts.Grouping {
+		grouping[k] = v
+	}
+	for k, v := range grouping {
+		// 值为空的分组键不能推送
+		if v != "" {
+			pusher = pusher.Grouping(k, v)
+		}
+	}
+	if opts.Username != "" {
+		pusher = pusher.BasicAuth(opts.Username, opts.Password)
+	}
+
+	p := &Pusher{
+		pusher:   pusher,
+		method:   opts.Method,
+		interval: opts.Interval,
+		timeout:  timeout,
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if p.interval > 0 {
+		go p.run()
+	} else {
+		close(p.done)
+	}
+	return p, nil
+}
+
+// Push 立即推送一次
+func (p *Pusher) Push(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	if p.method == PushMethodPush {
+		return p.pusher.PushContext(ctx)
+	}
+	return p.pusher.AddContext(ctx)
+}
+
+// Stop 停止定期推送，并推送最终的指标
+func (p *Pusher) Stop(ctx context.Context) error {
+	p.stopOnce.Do(func() {
+		close(p.quit)
+	})
+	<-p.done
+	return p.Push(ctx)
+}
+
+// Err 定期推送最后一次的错误，成功时为nil
+func (p *Pusher) Err() error {
+	p.errMu.Lock()
+	defer p.errMu.Unlock()
+	return p.lastErr
+}
+
+func (p *Pusher) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := p.Push(context.Background())
+			p.errMu.Lock()
+			p.lastErr = err
+			p.errMu.Unlock()
+		case <-p.quit:
+			return
+		}
+	}
+}
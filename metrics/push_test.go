@@ -0,0 +1,129 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/environment"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+)
+
+// pushgatewayStub 模拟Pushgateway，记录收到的请求
+type pushgatewayStub struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   []string
+}
+
+func (s *pushgatewayStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, _ := io.ReadAll(r.Body)
+	s.mu.Lock()
+	s.requests = append(s.requests, r)
+	s.bodies = append(s.bodies, string(b))
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *pushgatewayStub) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.requests)
+}
+
+func TestUnit_pushOnStop(t *testing.T) {
+	assert := assert.New(t)
+
+	stub := &pushgatewayStub{}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	savedEnv := environment.ExecENV
+	environment.ExecENV = "Develop"
+	defer func() { environment.ExecENV = savedEnv }()
+
+	r := prometheus.NewRegistry()
+	c := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_runs_total", Help: "test"})
+	r.MustRegister(c)
+	c.Add(3)
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	assert.NoError(os.WriteFile(passwordFile, []byte("pass\n"), 0o600))
+	p, err := NewPusher(r, PushOptions{
+		URL:          srv.URL,
+		Job:          "batch",
+		Grouping:     map[string]string{"task": "run"},
+		Username:     "user",
+		Password:     "ignored",
+		PasswordFile: passwordFile,
+	})
+	assert.NoError(err)
+	// 使用文本格式以便检查内容
+	p.pusher = p.pusher.Format(expfmt.NewFormat(expfmt.TypeTextPlain))
+	assert.Zero(stub.count(), "未设定间隔时不定期推送")
+
+	assert.NoError(p.Stop(context.Background()))
+	assert.Equal(1, stub.count())
+
+	req := stub.requests[0]
+	assert.Equal(http.MethodPost, req.Method)
+	assert.True(strings.HasPrefix(req.URL.Path, "/metrics/job/batch/"), req.URL.Path)
+	for _, kv := range []string{"/instance/" + environment.Hostname, "/env/Develop", "/task/run"} {
+		assert.Contains(req.URL.Path, kv)
+	}
+	user, pass, ok := req.BasicAuth()
+	assert.True(ok)
+	assert.Equal("user", user)
+	assert.Equal("pass", pass)
+	assert.Contains(stub.bodies[0], "test_runs_total 3")
+}
+
+func TestUnit_pushInterval(t *testing.T) {
+	assert := assert.New(t)
+
+	stub := &pushgatewayStub{}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	p, err := NewPusher(prometheus.NewRegistry(), PushOptions{
+		URL:      srv.URL,
+		Method:   PushMethodPush,
+		Interval: 20 * time.Millisecond,
+	})
+	assert.NoError(err)
+	assert.Eventually(func() bool { return stub.count() >= 2 }, time.Second, 10*time.Millisecond)
+	assert.NoError(p.Err())
+
+	assert.NoError(p.Stop(context.Background()))
+	n := stub.count()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(n, stub.count(), "停止后不再定期推送")
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	for _, req := range stub.requests {
+		assert.Equal(http.MethodPut, req.Method)
+		assert.True(strings.HasPrefix(req.URL.Path, "/metrics/job/httpserver/"), req.URL.Path)
+	}
+}
+
+func TestUnit_pushInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	// 推送方式在生成时检查，不等到第一次推送
+	_, err := NewPusher(prometheus.NewRegistry(), PushOptions{URL: "http://pushgateway:9091", Method: "put"})
+	assert.ErrorContains(err, `push method "put" not supported`)
+	_, err = NewPusher(prometheus.NewRegistry(), PushOptions{URL: "http://pushgateway:9091", Username: "user"})
+	assert.Error(err)
+	_, err = NewPusher(prometheus.NewRegistry(), PushOptions{URL: "http://pushgateway:9091", Username: "user", PasswordFile: filepath.Join(t.TempDir(), "missing")})
+	assert.Error(err)
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"context"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/protocol"
+)
+
+// Recorders 把指标同时记录到多个 MetricsRecorder（Prometheus注册表、OTLP、StatsD、SLO等）。
+// 标签组合超过上限时先归入other，所有后端使用相同的标签
+type Recorders []protocol.MetricsRecorder
+
+var _ protocol.MetricsRecorder = Recorders(nil)
+
+func (rs Recorders) AddCounter(ctx context.Context, name string, value float64, labels map[string]string) {
+	labels = limitLabelMap(name, labels)
+	for _, r := range rs {
+		r.AddCounter(ctx, name, value, labels)
+	}
+}
+
+func (rs Recorders) SetGauge(ctx context.Context, name string, value float64, labels map[string]string) {
+	labels = limitLabelMap(name, labels)
+	for _, r := range rs {
+		r.SetGauge(ctx, name, value, labels)
+	}
+}
+
+func (rs Recorders) AddGauge(ctx context.Context, name string, value float64, labels map[string]string) {
+	labels = limitLabelMap(name, labels)
+	for _, r := range rs {
+		r.AddGauge(ctx, name, value, labels)
+	}
+}
+
+func (rs Recorders) ObserveHistogram(ctx context.Context, name string, value float64, labels map[string]string) {
+	labels = limitLabelMap(name, labels)
+	for _, r := range rs {
+		r.ObserveHistogram(ctx, name, value, labels)
+	}
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnit_recorders(t *testing.T) {
+	assert := assert.New(t)
+
+	savedOptions, savedLimiter, savedDropped := options, limiter, droppedObservations
+	defer func() { options, limiter, droppedObservations = savedOptions, savedLimiter, savedDropped }()
+	options = Options{Cardinality: CardinalityOptions{Limit: 1}}
+	limiter = &seriesLimiter{seen: map[string]map[string]struct{}{}}
+	registerCardinality(prometheus.NewRegistry())
+
+	r := prometheus.NewRegistry()
+	p := NewPrometheusRecorder(r)
+	m := NewMemoryRecorder()
+	recorders := Recorders{p, m}
+	ctx := context.Background()
+
+	// 所有后端记录相同的指标，超过上限的标签组合归入other
+	recorders.AddCounter(ctx, "jobs_total", 1, map[string]string{"queue": "mail"})
+	recorders.AddCounter(ctx, "jobs_total", 1, map[string]string{"queue": "sms"})
+	recorders.AddGauge(ctx, "workers", 2, nil)
+	recorders.ObserveHistogram(ctx, "job_duration_seconds", 0.3, map[string]string{"queue": "mail"})
+
+	assert.Equal(1.0, m.Counter("jobs_total", map[string]string{"queue": "mail"}))
+	assert.Equal(1.0, m.Counter("jobs_total", map[string]string{"queue": OtherLabelValue}))
+	assert.Equal(2.0, m.Gauge("workers", nil))
+	assert.Equal([]float64{0.3}, m.Observations("job_duration_seconds", map[string]string{"queue": "mail"}))
+	assert.Equal(1.0, testutil.ToFloat64(p.counters["jobs_total"].WithLabelValues(OtherLabelValue)))
+
+	// 经过多个后端也只计一次丢弃
+	assert.Equal(1.0, testutil.ToFloat64(droppedObservations.WithLabelValues("jobs_total")))
+}
@@ -0,0 +1,256 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultRulesLatencyThreshold = time.Second
+	defaultRulesErrorRatio       = 0.05
+	defaultRulesFor              = 5 * time.Minute
+	rulesRateWindow              = "5m"
+)
+
+// 延时的分位数，对应录制规则 job_route:httpserver_http_request_duration_seconds:p99_5m 等
+var rulesQuantiles = []float64{0.5, 0.9, 0.99}
+
+// RulesOptions 生成Prometheus规则的配置
+type RulesOptions struct {
+	Selector         string        // 追加到所有指标的标签选择器，如 namespace="default"
+	LatencyThreshold time.Duration // p99延时告警的阈值，默认使用延时SLO中最小的threshold，没有延时SLO时为1秒
+	ErrorRatio       float64       // 5xx（含连接中断）比例告警的阈值，默认0.05
+	For              time.Duration // 条件持续多久后告警，默认5分钟
+}
+
+// RuleFile Prometheus的规则文件（rule_files 指定的文件）
+type RuleFile struct {
+	Groups []RuleGroup `yaml:"groups" json:"groups"`
+}
+
+// RuleGroup 规则组
+type RuleGroup struct {
+	Name  string `yaml:"name" json:"name"`
+	Rules []Rule `yaml:"rules" json:"rules"`
+}
+
+// Rule 录制规则或告警规则
+type Rule struct {
+	Record      string            `yaml:"record,omitempty" json:"record,omitempty"`
+	Alert       string            `yaml:"alert,omitempty" json:"alert,omitempty"`
+	Expr        string            `yaml:"expr" json:"expr"`
+	For         string            `yaml:"for,omitempty" json:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty" json:"annotations,omitempty"`
+}
+
+// PrometheusRule Prometheus Operator 的 PrometheusRule 资源
+type PrometheusRule struct {
+	APIVersion string             `yaml:"apiVersion" json:"apiVersion"`
+	Kind       string             `yaml:"kind" json:"kind"`
+	Metadata   PrometheusRuleMeta `yaml:"metadata" json:"metadata"`
+	Spec       RuleFile           `yaml:"spec" json:"spec"`
+}
+
+// PrometheusRuleMeta PrometheusRule 资源的metadata
+type PrometheusRuleMeta struct {
+	Name      string            `yaml:"name" json:"name"`
+	Namespace string            `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	Labels    map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+}
+
+// NewPrometheusRule 把规则文件包装为 PrometheusRule 资源，labels 需和Prometheus的 ruleSelector 一致
+func NewPrometheusRule(name, namespace string, labels map[string]string, rules RuleFile) PrometheusRule {
+	return PrometheusRule{
+		APIVersion: "monitoring.coreos.com/v1",
+		Kind:       "PrometheusRule",
+		Metadata:   PrometheusRuleMeta{Name: name, Namespace: namespace, Labels: labels},
+		Spec:       rules,
+	}
+}
+
+// GenerateRules 按注册表中实际注册的指标生成录制规则和告警规则，没有注册的指标不生成相应的规则
+func GenerateRules(r prometheus.Collector, opts RulesOptions) RuleFile {
+	if opts.LatencyThreshold <= 0 {
+		opts.LatencyThreshold = latencySLOThreshold()
+	}
+	if opts.ErrorRatio <= 0 {
+		opts.ErrorRatio = defaultRulesErrorRatio
+	}
+	if opts.For <= 0 {
+		opts.For = defaultRulesFor
+	}
+	names := RegisteredNames(r)
+	sel := func(matchers ...string) string {
+		if opts.Selector != "" {
+			matchers = append([]string{opts.Selector}, matchers...)
+		}
+		if len(matchers) == 0 {
+			return ""
+		}
+		return "{" + strings.Join(matchers, ",") + "}"
+	}
+	forDuration := formatWindow(opts.For)
+
+	var records, alerts []Rule
+	if names[httpRequestDurationName] {
+		for _, q := range rulesQuantiles {
+			records = append(records, Rule{
+				Record: quantileRecord(q),
+				Expr: fmt.Sprintf("histogram_quantile(%s, sum by (job, route, le) (rate(%s_bucket%s[%s])))",
+					strconv.FormatFloat(q, 'f', -1, 64), httpRequestDurationName, sel(), rulesRateWindow),
+			})
+		}
+		alerts = append(alerts, Rule{
+			Alert:  "HttpserverHighLatency",
+			Expr:   fmt.Sprintf("%s > %s", quantileRecord(0.99), strconv.FormatFloat(opts.LatencyThreshold.Seconds(), 'f', -1, 64)),
+			For:    forDuration,
+			Labels: map[string]string{"severity": "warning"},
+			Annotations: map[string]string{
+				"summary":     "httpserver p99 latency is high",
+				"description": fmt.Sprintf("p99 latency of {{ $labels.route }} is {{ $value | humanizeDuration }}, above %s.", opts.LatencyThreshold),
+			},
+		})
+	}
+	if names[httpRequestsTotalName] {
+		records = append(records,
+			Rule{
+				Record: "job_route:httpserver_http_requests:rate" + rulesRateWindow,
+				Expr:   fmt.Sprintf("sum by (job, route) (rate(%s%s[%s]))", httpRequestsTotalName, sel(), rulesRateWindow),
+			},
+			Rule{
+				Record: "job_route:httpserver_http_requests_errors:ratio_rate" + rulesRateWindow,
+				Expr: fmt.Sprintf("sum by (job, route) (rate(%s%s[%s])) / sum by (job, route) (rate(%s%s[%s]))",
+					httpRequestsTotalName, sel(`status_class=~"5xx|`+StatusClassAborted+`"`), rulesRateWindow, httpRequestsTotalName, sel(), rulesRateWindow),
+			},
+		)
+		alerts = append(alerts, Rule{
+			Alert:  "HttpserverHighErrorRate",
+			Expr:   fmt.Sprintf("job_route:httpserver_http_requests_errors:ratio_rate%s > %s", rulesRateWindow, strconv.FormatFloat(opts.ErrorRatio, 'f', -1, 64)),
+			For:    forDuration,
+			Labels: map[string]string{"severity": "critical"},
+			Annotations: map[string]string{
+				"summary":     "httpserver is returning 5xx",
+				"description": fmt.Sprintf("{{ $value | humanizePercentage }} of requests to {{ $labels.route }} failed, above %s.", strconv.FormatFloat(opts.ErrorRatio*100, 'f', -1, 64)+"%"),
+			},
+		})
+	}
+	if names[lifecycleStateName] {
+		alerts = append(alerts, Rule{
+			Alert:  "HttpserverPodNotReady",
+			Expr:   fmt.Sprintf("max by (job, instance) (%s%s) == 0", lifecycleStateName, sel(`state="`+LifecycleReady+`"`)),
+			For:    forDuration,
+			Labels: map[string]string{"severity": "warning"},
+			Annotations: map[string]string{
+				"summary":     "httpserver is not ready",
+				"description": fmt.Sprintf("{{ $labels.instance }} has not been ready for more than %s.", forDuration),
+			},
+		})
+	}
+	if names[sloBurnAlertName] {
+		for _, s := range []struct{ window, severity string }{{"page", "critical"}, {"ticket", "warning"}} {
+			alerts = append(alerts, Rule{
+				Alert:  "HttpserverSLOErrorBudgetBurn",
+				Expr:   fmt.Sprintf("max by (job, slo, long, short) (%s%s) == 1", sloBurnAlertName, sel(`severity="`+s.window+`"`)),
+				For:    "2m",
+				Labels: map[string]string{"severity": s.severity},
+				Annotations: map[string]string{
+					"summary":     "httpserver is burning its error budget",
+					"description": "SLO {{ $labels.slo }} burn rate over {{ $labels.long }} and {{ $labels.short }} is above the threshold.",
+				},
+			})
+		}
+	}
+
+	file := RuleFile{Groups: []RuleGroup{}}
+	if len(records) > 0 {
+		file.Groups = append(file.Groups, RuleGroup{Name: "httpserver.rules", Rules: records})
+	}
+	if len(alerts) > 0 {
+		file.Groups = append(file.Groups, RuleGroup{Name: "httpserver.alerts", Rules: alerts})
+	}
+	return file
+}
+
+// quantileRecord 延时分位数的录制规则名
+func quantileRecord(q float64) string {
+	return fmt.Sprintf("job_route:%s:p%s_%s", httpRequestDurationName, strconv.FormatFloat(q*100, 'f', -1, 64), rulesRateWindow)
+}
+
+// latencySLOThreshold 延时SLO中最小的threshold
+func latencySLOThreshold() time.Duration {
+	var threshold time.Duration
+	for _, o := range options.SLO.Objectives {
+		if o.Type == SLOLatency && o.Threshold > 0 && (threshold == 0 || o.Threshold < threshold) {
+			threshold = o.Threshold
+		}
+	}
+	if threshold == 0 {
+		return defaultRulesLatencyThreshold
+	}
+	return threshold
+}
+
+// 本包生成的指标的Desc对应的指标名。Desc没有取得名称的方法，所以在生成指标时记录
+var (
+	descNamesMu sync.Mutex
+	descNames   = map[*prometheus.Desc]string{}
+)
+
+// namedDesc 记录Desc对应的指标名
+func namedDesc(name string, d *prometheus.Desc) *prometheus.Desc {
+	descNamesMu.Lock()
+	defer descNamesMu.Unlock()
+	descNames[d] = name
+	return d
+}
+
+// named 记录只有一个指标名的collector（如 CounterVec、GaugeFunc）的Desc对应的指标名
+func named[T prometheus.Collector](name string, c T) T {
+	for _, d := range describe(c) {
+		namedDesc(name, d)
+	}
+	return c
+}
+
+// describe collector的所有Desc
+func describe(c prometheus.Collector) []*prometheus.Desc {
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		c.Describe(ch)
+		close(ch)
+	}()
+	var descs []*prometheus.Desc
+	for d := range ch {
+		descs = append(descs, d)
+	}
+	return descs
+}
+
+// RegisteredNames 注册表中注册的所有指标名。本包生成的指标按Desc取得，没有时间序列时也包括；
+// 其他指标（如进程和Go运行时指标）取自注册表 Gather 的结果
+func RegisteredNames(r prometheus.Collector) map[string]bool {
+	names := map[string]bool{}
+	descs := describe(r)
+	descNamesMu.Lock()
+	for _, d := range descs {
+		if name, ok := descNames[d]; ok {
+			names[name] = true
+		}
+	}
+	descNamesMu.Unlock()
+
+	if g, ok := r.(prometheus.Gatherer); ok {
+		// 部分指标收集失败时仍使用已收集的结果
+		families, _ := g.Gather()
+		for _, f := range families {
+			names[f.GetName()] = true
+		}
+	}
+	return names
+}
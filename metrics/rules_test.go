@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnit_generateRules(t *testing.T) {
+	assert := assert.New(t)
+
+	r := prometheus.NewRegistry()
+	r.MustRegister(
+		// 没有时间序列的指标按生成时记录的名称取得
+		named(httpRequestsTotalName, prometheus.NewCounterVec(prometheus.CounterOpts{Name: httpRequestsTotalName, Help: "test"}, httpLabels)),
+		named(httpRequestDurationName, prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: httpRequestDurationName, Help: "test"}, httpLabels)),
+	)
+	tracker, err := NewSLOTracker(SLOOptions{Objectives: []SLOObjective{
+		{Name: "availability", Type: SLOAvailability, Target: 0.999},
+	}})
+	assert.NoError(err)
+	r.MustRegister(tracker)
+
+	names := RegisteredNames(r)
+	assert.True(names[httpRequestDurationName])
+	assert.True(names[sloBurnAlertName])
+	assert.False(names[lifecycleStateName])
+
+	// 其他包生成的指标取自 Gather 的结果，没有时间序列时不包括
+	foreign := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "foreign_total", Help: "test"}, []string{"kind"})
+	r.MustRegister(foreign)
+	assert.False(RegisteredNames(r)["foreign_total"])
+	foreign.WithLabelValues("a").Inc()
+	assert.True(RegisteredNames(r)["foreign_total"])
+
+	file := GenerateRules(r, RulesOptions{Selector: `job="httpserver"`, LatencyThreshold: 250 * time.Millisecond, For: 10 * time.Minute})
+	if !assert.Len(file.Groups, 2) {
+		return
+	}
+
+	records := map[string]string{}
+	for _, rule := range file.Groups[0].Rules {
+		records[rule.Record] = rule.Expr
+	}
+	assert.Equal(`histogram_quantile(0.99, sum by (job, route, le) (rate(httpserver_http_request_duration_seconds_bucket{job="httpserver"}[5m])))`,
+		records["job_route:httpserver_http_request_duration_seconds:p99_5m"])
+	assert.Contains(records, "job_route:httpserver_http_request_duration_seconds:p50_5m")
+	assert.Contains(records, "job_route:httpserver_http_request_duration_seconds:p90_5m")
+	assert.Equal(`sum by (job, route) (rate(httpserver_http_requests_total{job="httpserver",status_class=~"5xx|aborted"}[5m])) / sum by (job, route) (rate(httpserver_http_requests_total{job="httpserver"}[5m]))`,
+		records["job_route:httpserver_http_requests_errors:ratio_rate5m"])
+
+	alerts := map[string]Rule{}
+	for _, rule := range file.Groups[1].Rules {
+		alerts[rule.Alert+"/"+rule.Labels["severity"]] = rule
+	}
+	assert.Equal("job_route:httpserver_http_request_duration_seconds:p99_5m > 0.25", alerts["HttpserverHighLatency/warning"].Expr)
+	assert.Equal("10m", alerts["HttpserverHighLatency/warning"].For)
+	assert.Equal("job_route:httpserver_http_requests_errors:ratio_rate5m > 0.05", alerts["HttpserverHighErrorRate/critical"].Expr)
+	assert.Contains(alerts, "HttpserverSLOErrorBudgetBurn/critical")
+	assert.Contains(alerts, "HttpserverSLOErrorBudgetBurn/warning")
+	// 没有注册生命周期状态的指标
+	assert.NotContains(alerts, "HttpserverPodNotReady/warning")
+
+	rule := NewPrometheusRule("httpserver", "monitoring", map[string]string{"release": "prometheus"}, file)
+	assert.Equal("monitoring.coreos.com/v1", rule.APIVersion)
+	assert.Equal("PrometheusRule", rule.Kind)
+	assert.Equal(file, rule.Spec)
+}
+
+func TestUnit_generateRulesEmpty(t *testing.T) {
+	assert := assert.New(t)
+
+	file := GenerateRules(prometheus.NewRegistry(), RulesOptions{})
+	assert.Empty(file.Groups)
+}
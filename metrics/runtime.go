@@ -0,0 +1,160 @@
+package metrics
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/environment"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// 服务的生命周期状态
+const (
+	LifecycleStarting = "starting" // 启动中，准备工作尚未完成
+	LifecycleReady    = "ready"    // 准备就绪，可以接收请求
+	LifecycleStopping = "stopping" // 收到退出信号，正在处理现有请求和收尾工作
+	LifecycleStopped  = "stopped"  // 已完全停止
+)
+
+const (
+	buildInfoName      = "httpserver_build_info"
+	uptimeName         = "httpserver_uptime_seconds"
+	lifecycleStateName = "httpserver_lifecycle_state"
+
+	containerCPUQuotaName    = "httpserver_container_cpu_quota_cores"
+	containerMemoryLimitName = "httpserver_container_memory_limit_bytes"
+	containerMemoryUsageName = "httpserver_container_memory_usage_bytes"
+	goSoftMemoryLimitName    = "httpserver_go_memory_limit_bytes"
+)
+
+var lifecycleStates = []string{LifecycleStarting, LifecycleReady, LifecycleStopping, LifecycleStopped}
+
+// CollectorOptions 运行时相关指标的开关
+type CollectorOptions struct {
+	Process bool `mapstructure:"process"` // 进程的CPU、内存、文件描述符等指标（process_*）
+	Go      bool `mapstructure:"go"`      // Go运行时的协程、GC、内存等指标（go_*）
+	// 从cgroup读取的容器的CPU上限、内存上限和使用量，以及Go运行时的软内存上限（httpserver_container_*），读取不到cgroup时不输出
+	Container bool `mapstructure:"container"`
+}
+
+var (
+	lifecycleState   *prometheus.GaugeVec
+	lifecycleMu      sync.Mutex
+	lifecycleCurrent = LifecycleStarting // 当前的状态，没有加载注册表时也记录
+)
+
+// registerRuntime 注册进程和Go运行时指标、构建信息、运行时间和生命周期状态
+func registerRuntime(r *prometheus.Registry, opts CollectorOptions) {
+	if opts.Process {
+		r.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	}
+	if opts.Go {
+		r.MustRegister(collectors.NewGoCollector())
+	}
+	if opts.Container && environment.ReadResources().CgroupVersion != 0 {
+		registerContainer(r)
+	}
+
+	// 构建信息，值固定为1，信息在标签中
+	buildInfo := named(buildInfoName, prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: buildInfoName,
+		Help: "A metric with a constant '1' value labeled by version, commit and goversion from which httpserver was built.",
+		ConstLabels: prometheus.Labels{
+			"version":   buildVersion(),
+			"commit":    orUnknown(environment.CommitID),
+			"goversion": runtime.Version(),
+		},
+	}))
+	buildInfo.Set(1)
+
+	uptime := named(uptimeName, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: uptimeName,
+		Help: "The number of seconds since httpserver started.",
+	}, func() float64 {
+		return time.Since(environment.StartTime).Seconds()
+	}))
+
+	// 当前状态的值为1，其他状态为0
+	lifecycleState = named(lifecycleStateName, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: lifecycleStateName,
+		Help: "The current lifecycle state of httpserver, 1 for the current state and 0 for the others.",
+	}, []string{"state"}))
+	for _, s := range lifecycleStates {
+		lifecycleState.WithLabelValues(s)
+	}
+	lifecycleMu.Lock()
+	lifecycleState.WithLabelValues(lifecycleCurrent).Set(1)
+	lifecycleMu.Unlock()
+
+	r.MustRegister(buildInfo, uptime, lifecycleState)
+}
+
+// SetLifecycleState 设定服务当前的生命周期状态
+func SetLifecycleState(state string) {
+	lifecycleMu.Lock()
+	defer lifecycleMu.Unlock()
+	setLifecycleState(state)
+}
+
+// CompareAndSetLifecycleState 当前状态为from时改为to，返回是否已改变。
+// 准备工作完成时用于避免覆盖准备期间收到退出信号后的stopping
+func CompareAndSetLifecycleState(from, to string) bool {
+	lifecycleMu.Lock()
+	defer lifecycleMu.Unlock()
+	if lifecycleCurrent != from {
+		return false
+	}
+	setLifecycleState(to)
+	return true
+}
+
+// setLifecycleState 记录当前状态并更新指标，调用方需持有 lifecycleMu
+func setLifecycleState(state string) {
+	lifecycleCurrent = state
+	if registry == nil {
+		return
+	}
+	for _, s := range lifecycleStates {
+		v := 0.0
+		if s == state {
+			v = 1
+		}
+		lifecycleState.WithLabelValues(s).Set(v)
+	}
+}
+
+// buildVersion 版本未注入时使用编译阶段注入的信息
+func buildVersion() string {
+	if environment.Version != "" {
+		return environment.Version
+	}
+	return orUnknown(environment.BuildInfo)
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+// registerContainer 注册容器的资源限制和使用量，每次抓取时从cgroup读取。没有限制时值为0
+func registerContainer(r *prometheus.Registry) {
+	gauge := func(name, help string, value func(environment.Resources) float64) prometheus.Collector {
+		return named(name, prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, func() float64 {
+			return value(environment.ReadResources())
+		}))
+	}
+	r.MustRegister(
+		gauge(containerCPUQuotaName, "The CPU quota of the container in cores, 0 if unlimited.",
+			func(res environment.Resources) float64 { return res.CPUQuota }),
+		gauge(containerMemoryLimitName, "The memory limit of the container in bytes, 0 if unlimited.",
+			func(res environment.Resources) float64 { return float64(res.MemoryLimit) }),
+		gauge(containerMemoryUsageName, "The current memory usage of the container in bytes, including page cache.",
+			func(res environment.Resources) float64 { return float64(res.MemoryUsage) }),
+		gauge(goSoftMemoryLimitName, "The soft memory limit of the Go runtime (GOMEMLIMIT) in bytes, 0 if unlimited.",
+			func(res environment.Resources) float64 { return float64(res.GoMemoryLimit) }),
+	)
+}
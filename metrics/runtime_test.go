@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnit_registerRuntime(t *testing.T) {
+	assert := assert.New(t)
+
+	r := prometheus.NewRegistry()
+	registerRuntime(r, CollectorOptions{})
+	assert.NoError(testutil.GatherAndCompare(r, strings.NewReader(fmt.Sprintf(`
+# HELP httpserver_build_info A metric with a constant '1' value labeled by version, commit and goversion from which httpserver was built.
+# TYPE httpserver_build_info gauge
+httpserver_build_info{commit="unknown",goversion=%q,version="unknown"} 1
+`, runtime.Version())), buildInfoName))
+	assert.Equal(1, testutil.CollectAndCount(r, uptimeName))
+	// 没有开启时不输出进程和Go运行时指标
+	assert.Equal(0, testutil.CollectAndCount(r, "process_cpu_seconds_total", "go_goroutines"))
+
+	registerContainer(r)
+	assert.Equal(4, testutil.CollectAndCount(r, containerCPUQuotaName, containerMemoryLimitName, containerMemoryUsageName, goSoftMemoryLimitName))
+}
+
+func TestUnit_lifecycleState(t *testing.T) {
+	assert := assert.New(t)
+
+	r := LoadRegistry()
+	defer SetLifecycleState(LifecycleStarting)
+	state := func(current string) string {
+		var b strings.Builder
+		b.WriteString("# HELP httpserver_lifecycle_state The current lifecycle state of httpserver, 1 for the current state and 0 for the others.\n")
+		b.WriteString("# TYPE httpserver_lifecycle_state gauge\n")
+		for _, s := range lifecycleStates {
+			v := 0
+			if s == current {
+				v = 1
+			}
+			fmt.Fprintf(&b, "httpserver_lifecycle_state{state=%q} %d\n", s, v)
+		}
+		return b.String()
+	}
+
+	SetLifecycleState(LifecycleStarting)
+	assert.True(CompareAndSetLifecycleState(LifecycleStarting, LifecycleReady))
+	assert.NoError(testutil.GatherAndCompare(r, strings.NewReader(state(LifecycleReady)), lifecycleStateName))
+
+	// 准备工作完成前收到退出信号时保持stopping
+	SetLifecycleState(LifecycleStarting)
+	SetLifecycleState(LifecycleStopping)
+	assert.False(CompareAndSetLifecycleState(LifecycleStarting, LifecycleReady))
+	assert.NoError(testutil.GatherAndCompare(r, strings.NewReader(state(LifecycleStopping)), lifecycleStateName))
+}
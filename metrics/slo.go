@@ -0,0 +1,365 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/protocol"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// SLO的种类
+const (
+	SLOAvailability = "availability" // 可用性：5xx和连接中断以外的应答为good
+	SLOLatency      = "latency"      // 延时：处理时间不超过threshold的请求为good
+)
+
+const (
+	defaultSLOWindow     = 30 * 24 * time.Hour
+	defaultSLOResolution = time.Minute
+	maxSLOBuckets        = 1 << 20
+)
+
+const (
+	sloTargetName    = "httpserver_slo_target_ratio"
+	sloSLIName       = "httpserver_slo_sli_ratio"
+	sloRemainingName = "httpserver_slo_error_budget_remaining_ratio"
+	sloBurnRateName  = "httpserver_slo_burn_rate"
+	sloBurnAlertName = "httpserver_slo_burn_rate_alert"
+)
+
+// sloAlertWindow 多窗口燃烧率告警的一组窗口。
+// 长窗口内消耗了错误预算的budget比例，且短窗口的燃烧率同样超过阈值时触发告警（参考Google SRE Workbook）。
+type sloAlertWindow struct {
+	severity string
+	long     time.Duration
+	short    time.Duration
+	budget   float64
+}
+
+var sloAlertWindows = []sloAlertWindow{
+	{severity: "page", long: time.Hour, short: 5 * time.Minute, budget: 0.02},
+	{severity: "page", long: 6 * time.Hour, short: 30 * time.Minute, budget: 0.05},
+	{severity: "ticket", long: 24 * time.Hour, short: 2 * time.Hour, budget: 0.1},
+	{severity: "ticket", long: 3 * 24 * time.Hour, short: 6 * time.Hour, budget: 0.1},
+}
+
+// SLOOptions SLO的配置
+type SLOOptions struct {
+	Objectives []SLOObjective `mapstructure:"objectives"` // 各SLO的定义，为空时不计算
+	Resolution time.Duration  `mapstructure:"resolution"` // 统计请求数的时间粒度，默认1分钟
+}
+
+// SLOObjective 单个SLO的定义
+type SLOObjective struct {
+	Name      string        `mapstructure:"name"`      // SLO名，作为指标的slo标签
+	Type      string        `mapstructure:"type"`      // 种类：availability/latency
+	Target    float64       `mapstructure:"target"`    // 目标值，如 0.999
+	Window    time.Duration `mapstructure:"window"`    // 计算错误预算的滚动窗口，默认30天
+	Threshold time.Duration `mapstructure:"threshold"` // latency：处理时间的上限
+	Routes    []string      `mapstructure:"routes"`    // 计入的路由模式，为空时计入所有路由
+}
+
+// SLOReport /slo 输出的报告
+type SLOReport struct {
+	Time       time.Time         `json:"time"`
+	Objectives []SLOObjectiveSLI `json:"objectives"`
+}
+
+// SLOObjectiveSLI 单个SLO的当前状态
+type SLOObjectiveSLI struct {
+	Name        string             `json:"name"`
+	Type        string             `json:"type"`
+	Target      float64            `json:"target"`
+	Window      string             `json:"window"`
+	Threshold   string             `json:"threshold,omitempty"`
+	Routes      []string           `json:"routes,omitempty"`
+	Total       uint64             `json:"total"`       // 窗口内的请求数
+	Good        uint64             `json:"good"`        // 窗口内达标的请求数
+	SLI         float64            `json:"sli"`         // 窗口内达标的比例，没有请求时为1
+	ErrorBudget SLOErrorBudget     `json:"errorBudget"` // 错误预算
+	BurnRates   map[string]float64 `json:"burnRates"`   // 各窗口的燃烧率，1表示正好在窗口结束时用完错误预算
+	Alerts      []SLOAlert         `json:"alerts"`      // 多窗口燃烧率告警
+}
+
+// SLOErrorBudget 窗口内的错误预算
+type SLOErrorBudget struct {
+	Allowed   float64 `json:"allowed"`   // 允许的不达标请求数
+	Consumed  float64 `json:"consumed"`  // 已消耗的比例
+	Remaining float64 `json:"remaining"` // 剩余的比例，超支时为负数
+}
+
+// SLOAlert 一组窗口的燃烧率告警
+type SLOAlert struct {
+	Severity  string  `json:"severity"`
+	Long      string  `json:"long"`
+	Short     string  `json:"short"`
+	Threshold float64 `json:"threshold"` // 燃烧率的阈值
+	Firing    bool    `json:"firing"`
+}
+
+// sloBucket 一个时间粒度内的请求数
+type sloBucket struct {
+	slot        int64 // 以粒度为单位的时刻，用于判断是否已过期
+	total, good uint64
+}
+
+// sloState 单个SLO的滚动窗口
+type sloState struct {
+	SLOObjective
+	routes  map[string]bool
+	buckets []sloBucket
+}
+
+// SLOTracker 在进程内按路由统计请求，计算错误预算和燃烧率
+type SLOTracker struct {
+	resolution time.Duration
+	now        func() time.Time
+
+	mu     sync.Mutex
+	states []*sloState
+
+	targetDesc     *prometheus.Desc
+	sliDesc        *prometheus.Desc
+	remainingDesc  *prometheus.Desc
+	burnRateDesc   *prometheus.Desc
+	alertStateDesc *prometheus.Desc
+}
+
+// NewSLOTracker 按配置生成SLO的统计，作为 MetricsRecorder 注入后统计所有经过 Metrics 中间件的请求
+func NewSLOTracker(opts SLOOptions) (*SLOTracker, error) {
+	resolution := opts.Resolution
+	if resolution <= 0 {
+		resolution = defaultSLOResolution
+	}
+
+	t := &SLOTracker{
+		resolution: resolution,
+		now:        time.Now,
+		targetDesc: namedDesc(sloTargetName, prometheus.NewDesc(sloTargetName,
+			"The target ratio of good requests.", []string{"slo"}, nil)),
+		sliDesc: namedDesc(sloSLIName, prometheus.NewDesc(sloSLIName,
+			"The ratio of good requests over the SLO window.", []string{"slo"}, nil)),
+		remainingDesc: namedDesc(sloRemainingName, prometheus.NewDesc(sloRemainingName,
+			"The remaining ratio of the error budget over the SLO window.", []string{"slo"}, nil)),
+		burnRateDesc: namedDesc(sloBurnRateName, prometheus.NewDesc(sloBurnRateName,
+			"The error budget burn rate over the window.", []string{"slo", "window"}, nil)),
+		alertStateDesc: namedDesc(sloBurnAlertName, prometheus.NewDesc(sloBurnAlertName,
+			"Whether the multi-window burn rate alert is firing.", []string{"slo", "severity", "long", "short"}, nil)),
+	}
+
+	names := map[string]bool{}
+	for _, o := range opts.Objectives {
+		if o.Window <= 0 {
+			o.Window = defaultSLOWindow
+		}
+		if err := o.validate(resolution); err != nil {
+			return nil, err
+		}
+		if names[o.Name] {
+			return nil, fmt.Errorf("slo %s: duplicated", o.Name)
+		}
+		names[o.Name] = true
+
+		s := &sloState{
+			SLOObjective: o,
+			buckets:      make([]sloBucket, (o.Window+resolution-1)/resolution),
+		}
+		if len(o.Routes) > 0 {
+			s.routes = make(map[string]bool, len(o.Routes))
+			for _, r := range o.Routes {
+				s.routes[r] = true
+			}
+		}
+		t.states = append(t.states, s)
+	}
+
+	return t, nil
+}
+
+// validate 检查SLO的定义
+func (o SLOObjective) validate(resolution time.Duration) error {
+	if o.Name == "" {
+		return fmt.Errorf("slo name is empty")
+	}
+	switch o.Type {
+	case SLOAvailability:
+	case SLOLatency:
+		if o.Threshold <= 0 {
+			return fmt.Errorf("slo %s: latency threshold must be > 0", o.Name)
+		}
+	default:
+		return fmt.Errorf("slo %s: type %q not supported", o.Name, o.Type)
+	}
+	if o.Target <= 0 || o.Target >= 1 {
+		return fmt.Errorf("slo %s: target must be between 0 and 1", o.Name)
+	}
+	if o.Window/resolution > maxSLOBuckets {
+		return fmt.Errorf("slo %s: window %s is too long for resolution %s", o.Name, o.Window, resolution)
+	}
+	return nil
+}
+
+var _ protocol.MetricsRecorder = (*SLOTracker)(nil)
+
+func (t *SLOTracker) AddCounter(context.Context, string, float64, map[string]string) {}
+func (t *SLOTracker) SetGauge(context.Context, string, float64, map[string]string)   {}
+func (t *SLOTracker) AddGauge(context.Context, string, float64, map[string]string)   {}
+
+// ObserveHistogram 按请求的处理时间统计，其他指标被忽略
+func (t *SLOTracker) ObserveHistogram(_ context.Context, name string, value float64, labels map[string]string) {
+	if name == httpRequestDurationName {
+		t.observeRequest(labels["route"], labels["status_class"], time.Duration(math.Round(value*float64(time.Second))))
+	}
+}
+
+func (t *SLOTracker) observeRequest(route, statusClass string, duration time.Duration) {
+	slot := t.now().UnixNano() / int64(t.resolution)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, s := range t.states {
+		if s.routes != nil && !s.routes[route] {
+			continue
+		}
+		good := statusClass != "5xx" && statusClass != StatusClassAborted
+		if s.Type == SLOLatency {
+			good = duration <= s.Threshold
+		}
+
+		b := &s.buckets[slot%int64(len(s.buckets))]
+		if b.slot != slot {
+			*b = sloBucket{slot: slot}
+		}
+		b.total++
+		if good {
+			b.good++
+		}
+	}
+}
+
+// sum 最近d时间内的请求数
+func (t *SLOTracker) sum(s *sloState, now int64, d time.Duration) (total, good uint64) {
+	n := int64(d / t.resolution)
+	if n < 1 {
+		n = 1
+	}
+	if n > int64(len(s.buckets)) {
+		n = int64(len(s.buckets))
+	}
+	for slot := now - n + 1; slot <= now; slot++ {
+		if b := s.buckets[slot%int64(len(s.buckets))]; b.slot == slot {
+			total += b.total
+			good += b.good
+		}
+	}
+	return total, good
+}
+
+// burnRate 窗口内不达标请求的比例除以错误预算的比例
+func (t *SLOTracker) burnRate(s *sloState, now int64, d time.Duration) float64 {
+	total, good := t.sum(s, now, d)
+	if total == 0 {
+		return 0
+	}
+	return float64(total-good) / float64(total) / (1 - s.Target)
+}
+
+// Report 各SLO的当前状态
+func (t *SLOTracker) Report() SLOReport {
+	now := t.now()
+	slot := now.UnixNano() / int64(t.resolution)
+	report := SLOReport{Time: now, Objectives: []SLOObjectiveSLI{}}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, s := range t.states {
+		r := SLOObjectiveSLI{
+			Name:      s.Name,
+			Type:      s.Type,
+			Target:    s.Target,
+			Window:    formatWindow(s.Window),
+			Routes:    s.Routes,
+			SLI:       1,
+			BurnRates: map[string]float64{},
+			Alerts:    []SLOAlert{},
+		}
+		if s.Type == SLOLatency {
+			r.Threshold = s.Threshold.String()
+		}
+
+		r.Total, r.Good = t.sum(s, slot, s.Window)
+		r.ErrorBudget.Allowed = float64(r.Total) * (1 - s.Target)
+		if r.Total > 0 {
+			r.SLI = float64(r.Good) / float64(r.Total)
+			r.ErrorBudget.Consumed = float64(r.Total-r.Good) / r.ErrorBudget.Allowed
+		}
+		r.ErrorBudget.Remaining = 1 - r.ErrorBudget.Consumed
+
+		for _, w := range sloAlertWindows {
+			if w.long > s.Window {
+				continue
+			}
+			long, short := t.burnRate(s, slot, w.long), t.burnRate(s, slot, w.short)
+			r.BurnRates[formatWindow(w.long)] = long
+			r.BurnRates[formatWindow(w.short)] = short
+			threshold := w.budget * float64(s.Window) / float64(w.long)
+			r.Alerts = append(r.Alerts, SLOAlert{
+				Severity:  w.severity,
+				Long:      formatWindow(w.long),
+				Short:     formatWindow(w.short),
+				Threshold: threshold,
+				Firing:    long > threshold && short > threshold,
+			})
+		}
+		r.BurnRates[formatWindow(s.Window)] = t.burnRate(s, slot, s.Window)
+
+		report.Objectives = append(report.Objectives, r)
+	}
+	return report
+}
+
+// Describe 实现 prometheus.Collector
+func (t *SLOTracker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.targetDesc
+	ch <- t.sliDesc
+	ch <- t.remainingDesc
+	ch <- t.burnRateDesc
+	ch <- t.alertStateDesc
+}
+
+// Collect 实现 prometheus.Collector，抓取时计算各SLO的当前状态
+func (t *SLOTracker) Collect(ch chan<- prometheus.Metric) {
+	for _, r := range t.Report().Objectives {
+		ch <- prometheus.MustNewConstMetric(t.targetDesc, prometheus.GaugeValue, r.Target, r.Name)
+		ch <- prometheus.MustNewConstMetric(t.sliDesc, prometheus.GaugeValue, r.SLI, r.Name)
+		ch <- prometheus.MustNewConstMetric(t.remainingDesc, prometheus.GaugeValue, r.ErrorBudget.Remaining, r.Name)
+		for window, rate := range r.BurnRates {
+			ch <- prometheus.MustNewConstMetric(t.burnRateDesc, prometheus.GaugeValue, rate, r.Name, window)
+		}
+		for _, a := range r.Alerts {
+			var firing float64
+			if a.Firing {
+				firing = 1
+			}
+			ch <- prometheus.MustNewConstMetric(t.alertStateDesc, prometheus.GaugeValue, firing, r.Name, a.Severity, a.Long, a.Short)
+		}
+	}
+}
+
+// formatWindow 把窗口的长度格式化为 5m、1h、30d 的形式
+func formatWindow(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return d.String()
+	}
+}
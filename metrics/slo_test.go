@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnit_sloTracker(t *testing.T) {
+	assert := assert.New(t)
+
+	tracker, err := NewSLOTracker(SLOOptions{Objectives: []SLOObjective{
+		{Name: "availability", Type: SLOAvailability, Target: 0.99, Window: 24 * time.Hour, Routes: []string{"/info"}},
+		{Name: "latency", Type: SLOLatency, Target: 0.9, Threshold: 500 * time.Millisecond},
+	}})
+	assert.NoError(err)
+
+	now := time.Date(2021, 11, 1, 12, 0, 0, 0, time.UTC)
+	tracker.now = func() time.Time { return now }
+	observe := func(route, class string, d time.Duration) {
+		tracker.ObserveHistogram(context.Background(), httpRequestDurationName, d.Seconds(), map[string]string{"route": route, "method": http.MethodGet, "status_class": class})
+	}
+
+	// 3小时前：100个请求全部达标
+	now = now.Add(-3 * time.Hour)
+	for i := 0; i < 100; i++ {
+		observe("/info", "2xx", 100*time.Millisecond)
+	}
+	// 现在：100个请求中1个5xx、1个中断，10个超时；其他路由不计入可用性
+	now = now.Add(3 * time.Hour)
+	for i := 0; i < 100; i++ {
+		switch {
+		case i < 1:
+			observe("/info", "5xx", 100*time.Millisecond)
+		case i < 2:
+			observe("/info", StatusClassAborted, 100*time.Millisecond)
+		case i < 12:
+			observe("/info", "2xx", time.Second)
+		default:
+			observe("/info", "2xx", 100*time.Millisecond)
+		}
+	}
+	observe("/run", "5xx", 100*time.Millisecond)
+
+	report := tracker.Report()
+	assert.Len(report.Objectives, 2)
+
+	a := report.Objectives[0]
+	assert.Equal("1d", a.Window)
+	assert.Equal(uint64(200), a.Total)
+	assert.Equal(uint64(198), a.Good)
+	assert.InDelta(0.99, a.SLI, 1e-9)
+	assert.InDelta(1.0, a.ErrorBudget.Consumed, 1e-9)
+	assert.InDelta(0.0, a.ErrorBudget.Remaining, 1e-9)
+	// 最近1小时的错误率为2%，燃烧率为2；1天窗口的告警阈值为 0.02*24h/1h = 0.48
+	assert.InDelta(2.0, a.BurnRates["1h"], 1e-9)
+	assert.InDelta(2.0, a.BurnRates["5m"], 1e-9)
+	assert.InDelta(1.0, a.BurnRates["1d"], 1e-9)
+	// 超过SLO窗口的告警窗口不计算
+	assert.Len(a.Alerts, 3)
+	assert.Equal(SLOAlert{Severity: "page", Long: "1h", Short: "5m", Threshold: 0.48, Firing: true}, a.Alerts[0])
+
+	l := report.Objectives[1]
+	assert.Equal("30d", l.Window)
+	assert.Equal("500ms", l.Threshold)
+	assert.Equal(uint64(201), l.Total)
+	assert.Equal(uint64(191), l.Good)
+	assert.Len(l.Alerts, 4)
+
+	// 超过窗口的请求不再计入
+	now = now.Add(22 * time.Hour)
+	a = tracker.Report().Objectives[0]
+	assert.Equal(uint64(100), a.Total)
+	assert.Equal(0.0, a.BurnRates["1h"])
+	assert.False(a.Alerts[0].Firing)
+
+	r := prometheus.NewRegistry()
+	r.MustRegister(tracker)
+	assert.NoError(testutil.GatherAndCompare(r, strings.NewReader(`
+# HELP httpserver_slo_target_ratio The target ratio of good requests.
+# TYPE httpserver_slo_target_ratio gauge
+httpserver_slo_target_ratio{slo="availability"} 0.99
+httpserver_slo_target_ratio{slo="latency"} 0.9
+`), "httpserver_slo_target_ratio"))
+	assert.Equal(2+2+2+14+7, testutil.CollectAndCount(tracker))
+}
+
+func TestUnit_sloValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, o := range []SLOObjective{
+		{Type: SLOAvailability, Target: 0.99},
+		{Name: "a", Type: "throughput", Target: 0.99},
+		{Name: "a", Type: SLOAvailability, Target: 1},
+		{Name: "a", Type: SLOLatency, Target: 0.99},
+		{Name: "a", Type: SLOAvailability, Target: 0.99, Window: 24 * 365 * 10 * time.Hour},
+	} {
+		_, err := NewSLOTracker(SLOOptions{Objectives: []SLOObjective{o}})
+		assert.Error(err, o)
+	}
+
+	_, err := NewSLOTracker(SLOOptions{Objectives: []SLOObjective{
+		{Name: "a", Type: SLOAvailability, Target: 0.99},
+		{Name: "a", Type: SLOAvailability, Target: 0.999},
+	}})
+	assert.Error(err)
+}
@@ -0,0 +1,368 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/protocol"
+)
+
+// StatsD的协议
+const (
+	StatsDFlavorStatsD    = "statsd"    // 原始的StatsD，不支持标签，标签的值依次追加到指标名后
+	StatsDFlavorDogStatsD = "dogstatsd" // DogStatsD，标签以 |#key:value 的形式输出
+)
+
+const (
+	defaultStatsDPrefix        = "httpserver."
+	defaultStatsDFlushInterval = time.Second
+	defaultStatsDBufferSize    = 1000
+	defaultStatsDUDPPacketSize = 1432 // 以太网MTU减去IP和UDP的头部
+	defaultStatsDUDSPacketSize = 8192
+	statsDUnixScheme           = "unix://"
+	statsDUDPScheme            = "udp://"
+)
+
+// StatsDOptions 向StatsD/DogStatsD输出指标的配置，和Prometheus的 /metrics 同时有效
+type StatsDOptions struct {
+	Address       string            `mapstructure:"address"`       // 代理的地址：host:port 或 udp://host:port 使用UDP，unix:///path 使用Unix socket，为空时不输出
+	Flavor        string            `mapstructure:"flavor"`        // 协议：statsd/dogstatsd，默认为statsd
+	Prefix        string            `mapstructure:"prefix"`        // 指标名的前缀，默认为 httpserver.
+	Tags          map[string]string `mapstructure:"tags"`          // 追加到所有指标的标签，只对dogstatsd有效
+	SampleRate    float64           `mapstructure:"samplerate"`    // 计数和计时的采样率（0-1），默认为1（不采样）
+	FlushInterval time.Duration     `mapstructure:"flushinterval"` // 客户端聚合后发送的间隔，默认1秒
+	BufferSize    int               `mapstructure:"buffersize"`    // 缓存的计时值超过该数量时提前发送，默认1000
+	MaxPacketSize int               `mapstructure:"maxpacketsize"` // 单个数据包的最大字节数，默认UDP为1432，Unix socket为8192
+}
+
+// statsdMetric 聚合的单位：指标名和已序列化的标签
+type statsdMetric struct {
+	name string
+	tags string
+}
+
+// statsdNames 输出到StatsD的指标名和标签的顺序，其他指标只通过Prometheus输出
+var statsdNames = map[string]struct {
+	name   string
+	labels []string
+}{
+	httpRequestsTotalName:   {"http.requests", httpLabels},
+	httpRequestDurationName: {"http.request.duration", httpLabels},
+	httpInFlightName:        {"http.requests.in_flight", httpInFlightLabels},
+	SleepDurationName:       {"sleep.duration", nil},
+}
+
+// StatsD 在客户端聚合请求的计数和计时，定期发送到StatsD/DogStatsD代理
+type StatsD struct {
+	opts StatsDOptions
+	conn net.Conn
+
+	mu       sync.Mutex
+	counters map[statsdMetric]int64
+	gauges   map[statsdMetric]int64
+	timings  map[statsdMetric][]float64
+	buffered int // 缓存的计时值的数量
+
+	flush    chan struct{}
+	quit     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+	errMu    sync.Mutex
+	lastErr  error // 最后一次发送的错误
+}
+
+// NewStatsD 连接代理并开始定期发送
+func NewStatsD(opts StatsDOptions) (*StatsD, error) {
+	switch opts.Flavor {
+	case "":
+		opts.Flavor = StatsDFlavorStatsD
+	case StatsDFlavorStatsD, StatsDFlavorDogStatsD:
+	default:
+		return nil, fmt.Errorf("statsd flavor %q not supported", opts.Flavor)
+	}
+	if opts.SampleRate < 0 || opts.SampleRate > 1 {
+		return nil, fmt.Errorf("statsd sample rate %v out of range (0, 1]", opts.SampleRate)
+	}
+	if opts.SampleRate == 0 {
+		opts.SampleRate = 1
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = defaultStatsDPrefix
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultStatsDFlushInterval
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = defaultStatsDBufferSize
+	}
+
+	network, address := "udp", strings.TrimPrefix(opts.Address, statsDUDPScheme)
+	packetSize := defaultStatsDUDPPacketSize
+	if strings.HasPrefix(opts.Address, statsDUnixScheme) {
+		network, address = "unixgram", strings.TrimPrefix(opts.Address, statsDUnixScheme)
+		packetSize = defaultStatsDUDSPacketSize
+	}
+	if opts.MaxPacketSize <= 0 {
+		opts.MaxPacketSize = packetSize
+	}
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &StatsD{
+		opts:     opts,
+		conn:     conn,
+		counters: map[statsdMetric]int64{},
+		gauges:   map[statsdMetric]int64{},
+		timings:  map[statsdMetric][]float64{},
+		flush:    make(chan struct{}, 1),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Close 停止输出，发送剩余的指标后关闭连接，之后记录的指标被忽略
+func (s *StatsD) Close() error {
+	s.stopOnce.Do(func() { close(s.quit) })
+	<-s.done
+	err := s.Flush()
+	if cerr := s.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Err 定期发送时最后一次的错误
+func (s *StatsD) Err() error {
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	return s.lastErr
+}
+
+func (s *StatsD) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.flush:
+		case <-s.quit:
+			return
+		}
+		err := s.Flush()
+		s.errMu.Lock()
+		s.lastErr = err
+		s.errMu.Unlock()
+	}
+}
+
+// Flush 立即发送聚合的指标。计数和计时发送后清零，gauge每次都发送当前值
+func (s *StatsD) Flush() error {
+	s.mu.Lock()
+	lines := make([]string, 0, len(s.counters)+len(s.gauges)+s.buffered)
+	for m, v := range s.counters {
+		lines = append(lines, s.line(m, strconv.FormatInt(v, 10), "c", true))
+	}
+	for m, v := range s.gauges {
+		lines = append(lines, s.line(m, strconv.FormatInt(v, 10), "g", false))
+	}
+	for m, values := range s.timings {
+		for _, v := range values {
+			lines = append(lines, s.line(m, strconv.FormatFloat(v, 'f', -1, 64), "ms", true))
+		}
+	}
+	s.counters = map[statsdMetric]int64{}
+	s.timings = map[statsdMetric][]float64{}
+	s.buffered = 0
+	s.mu.Unlock()
+
+	var lastErr error
+	for _, packet := range pack(lines, s.opts.MaxPacketSize) {
+		if _, err := s.conn.Write(packet); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// line 生成一行指标，如 httpserver.http.requests:1|c|@0.5|#route:/info
+func (s *StatsD) line(m statsdMetric, value, kind string, sampled bool) string {
+	var b strings.Builder
+	b.WriteString(m.name)
+	b.WriteByte(':')
+	b.WriteString(value)
+	b.WriteByte('|')
+	b.WriteString(kind)
+	if sampled && s.opts.SampleRate < 1 {
+		b.WriteString("|@")
+		b.WriteString(strconv.FormatFloat(s.opts.SampleRate, 'f', -1, 64))
+	}
+	if m.tags != "" {
+		b.WriteString("|#")
+		b.WriteString(m.tags)
+	}
+	return b.String()
+}
+
+// pack 把多行指标以换行分隔装入数据包，超过最大字节数的单行单独发送
+func pack(lines []string, maxSize int) [][]byte {
+	var packets [][]byte
+	var buf []byte
+	for _, l := range lines {
+		if len(buf) > 0 && len(buf)+1+len(l) > maxSize {
+			packets = append(packets, buf)
+			buf = nil
+		}
+		if len(buf) > 0 {
+			buf = append(buf, '\n')
+		}
+		buf = append(buf, l...)
+	}
+	if len(buf) > 0 {
+		packets = append(packets, buf)
+	}
+	return packets
+}
+
+// metric 按协议把标签序列化，statsd时标签的值依次追加到指标名后
+func (s *StatsD) metric(name string, tags ...string) statsdMetric {
+	name = s.opts.Prefix + name
+	if s.opts.Flavor == StatsDFlavorStatsD {
+		for i := 1; i < len(tags); i += 2 {
+			name += "." + statsdSegment(tags[i])
+		}
+		return statsdMetric{name: name}
+	}
+
+	pairs := make([]string, 0, len(s.opts.Tags)+len(tags)/2)
+	for k, v := range s.opts.Tags {
+		pairs = append(pairs, statsdTag(k, v))
+	}
+	sort.Strings(pairs)
+	for i := 0; i+1 < len(tags); i += 2 {
+		pairs = append(pairs, statsdTag(tags[i], tags[i+1]))
+	}
+	return statsdMetric{name: name, tags: strings.Join(pairs, ",")}
+}
+
+// statsdSegment 把标签的值转换为指标名中的一段，如 /info 转换为 info
+func statsdSegment(v string) string {
+	seg := strings.Trim(strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, v), "_")
+	if seg == "" {
+		return "root"
+	}
+	return seg
+}
+
+// statsdTag 生成DogStatsD的标签，去掉协议中有特殊含义的字符
+func statsdTag(k, v string) string {
+	return strings.NewReplacer(",", "_", "|", "_", "#", "_").Replace(k + ":" + v)
+}
+
+// sampled 按采样率决定是否记录
+func (s *StatsD) sampled() bool {
+	return s.opts.SampleRate >= 1 || rand.Float64() < s.opts.SampleRate
+}
+
+func (s *StatsD) count(m statsdMetric, n int64) {
+	if s.closed() || !s.sampled() {
+		return
+	}
+	s.mu.Lock()
+	s.counters[m] += n
+	s.mu.Unlock()
+}
+
+func (s *StatsD) timing(m statsdMetric, d time.Duration) {
+	if s.closed() || !s.sampled() {
+		return
+	}
+	s.mu.Lock()
+	s.timings[m] = append(s.timings[m], float64(d)/float64(time.Millisecond))
+	s.buffered++
+	full := s.buffered >= s.opts.BufferSize
+	s.mu.Unlock()
+	if full {
+		select {
+		case s.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *StatsD) gauge(m statsdMetric, delta int64) {
+	if s.closed() {
+		return
+	}
+	s.mu.Lock()
+	s.gauges[m] += delta
+	s.mu.Unlock()
+}
+
+var _ protocol.MetricsRecorder = (*StatsD)(nil)
+
+func (s *StatsD) AddCounter(_ context.Context, name string, value float64, labels map[string]string) {
+	if m, ok := s.lookup(name, labels); ok {
+		s.count(m, int64(value))
+	}
+}
+
+func (s *StatsD) SetGauge(_ context.Context, name string, value float64, labels map[string]string) {
+	if m, ok := s.lookup(name, labels); ok && !s.closed() {
+		s.mu.Lock()
+		s.gauges[m] = int64(value)
+		s.mu.Unlock()
+	}
+}
+
+func (s *StatsD) AddGauge(_ context.Context, name string, value float64, labels map[string]string) {
+	if m, ok := s.lookup(name, labels); ok {
+		s.gauge(m, int64(value))
+	}
+}
+
+// ObserveHistogram 以秒为单位的观测值作为毫秒的计时输出
+func (s *StatsD) ObserveHistogram(_ context.Context, name string, value float64, labels map[string]string) {
+	if m, ok := s.lookup(name, labels); ok {
+		s.timing(m, time.Duration(value*float64(time.Second)))
+	}
+}
+
+// lookup 按 statsdNames 转换指标名和标签，不输出的指标返回false
+func (s *StatsD) lookup(name string, labels map[string]string) (statsdMetric, bool) {
+	n, ok := statsdNames[name]
+	if !ok {
+		return statsdMetric{}, false
+	}
+	tags := make([]string, 0, 2*len(n.labels))
+	for _, l := range n.labels {
+		tags = append(tags, l, labels[l])
+	}
+	return s.metric(n.name, tags...), true
+}
+
+// closed 已调用 Close
+func (s *StatsD) closed() bool {
+	select {
+	case <-s.quit:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readPackets 读取代理收到的所有数据包，按行返回
+func readPackets(t *testing.T, conn net.PacketConn) []string {
+	var lines []string
+	buf := make([]byte, 65536)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func TestUnit_statsdDogStatsD(t *testing.T) {
+	assert := assert.New(t)
+
+	agent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(err)
+	defer agent.Close()
+
+	s, err := NewStatsD(StatsDOptions{
+		Address:       "udp://" + agent.LocalAddr().String(),
+		Flavor:        StatsDFlavorDogStatsD,
+		Tags:          map[string]string{"env": "test"},
+		FlushInterval: time.Hour,
+	})
+	assert.NoError(err)
+
+	ctx := context.Background()
+	done := RequestStarted(ctx, s, "/info", http.MethodGet)
+	ObserveRequest(ctx, s, "/info", http.MethodGet, http.StatusOK, 250*time.Millisecond, 0, 0)
+	ObserveRequest(ctx, s, "/info", http.MethodGet, http.StatusOK, 500*time.Millisecond, 0, 0)
+	s.ObserveHistogram(ctx, SleepDurationName, 1.5, nil)
+	// 不输出到StatsD的指标被忽略
+	s.AddCounter(ctx, "jobs_total", 1, nil)
+	assert.NoError(s.Flush())
+
+	assert.Equal([]string{
+		"httpserver.http.request.duration:250|ms|#env:test,route:/info,method:GET,status_class:2xx",
+		"httpserver.http.request.duration:500|ms|#env:test,route:/info,method:GET,status_class:2xx",
+		"httpserver.http.requests.in_flight:1|g|#env:test,route:/info,method:GET",
+		"httpserver.http.requests:2|c|#env:test,route:/info,method:GET,status_class:2xx",
+		"httpserver.sleep.duration:1500|ms|#env:test",
+	}, readPackets(t, agent))
+
+	// 计数和计时发送后清零，gauge发送当前值
+	done()
+	assert.NoError(s.Close())
+	assert.Equal([]string{"httpserver.http.requests.in_flight:0|g|#env:test,route:/info,method:GET"}, readPackets(t, agent))
+
+	// 关闭后记录的指标被忽略
+	ObserveRequest(ctx, s, "/info", http.MethodGet, http.StatusOK, time.Second, 0, 0)
+	assert.Empty(s.counters)
+	assert.Empty(s.timings)
+}
+
+func TestUnit_statsdPlain(t *testing.T) {
+	assert := assert.New(t)
+
+	agent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(err)
+	defer agent.Close()
+
+	s, err := NewStatsD(StatsDOptions{
+		Address:       agent.LocalAddr().String(),
+		Prefix:        "legacy.",
+		SampleRate:    1,
+		FlushInterval: time.Hour,
+		BufferSize:    1,
+	})
+	assert.NoError(err)
+	defer s.Close()
+
+	// 缓存的计时值达到BufferSize时提前发送
+	ObserveRequest(context.Background(), s, "/", http.MethodPost, http.StatusBadGateway, time.Second, 0, 0)
+	assert.Equal([]string{
+		"legacy.http.request.duration.root.POST.5xx:1000|ms",
+		"legacy.http.requests.root.POST.5xx:1|c",
+	}, readPackets(t, agent))
+}
+
+func TestUnit_statsdSampling(t *testing.T) {
+	assert := assert.New(t)
+
+	agent, err := net.ListenPacket("unixgram", filepath.Join(t.TempDir(), "dsd.socket"))
+	assert.NoError(err)
+	defer agent.Close()
+
+	s, err := NewStatsD(StatsDOptions{
+		Address:       "unix://" + agent.LocalAddr().String(),
+		Flavor:        StatsDFlavorDogStatsD,
+		SampleRate:    0.5,
+		FlushInterval: time.Hour,
+	})
+	assert.NoError(err)
+	defer s.Close()
+
+	for i := 0; i < 1000; i++ {
+		s.count(s.metric("jobs"), 1)
+	}
+	assert.NoError(s.Flush())
+	lines := readPackets(t, agent)
+	assert.Len(lines, 1)
+	assert.True(strings.HasPrefix(lines[0], "httpserver.jobs:"))
+	assert.True(strings.HasSuffix(lines[0], "|c|@0.5"))
+
+	_, err = NewStatsD(StatsDOptions{Address: "127.0.0.1:8125", Flavor: "graphite"})
+	assert.Error(err)
+	_, err = NewStatsD(StatsDOptions{Address: "127.0.0.1:8125", SampleRate: 2})
+	assert.Error(err)
+}
+
+func TestUnit_statsdPack(t *testing.T) {
+	assert := assert.New(t)
+
+	packets := pack([]string{"a:1|c", "b:1|c", "c:1|c", strings.Repeat("d", 20)}, 12)
+	assert.Equal([][]byte{[]byte("a:1|c\nb:1|c"), []byte("c:1|c"), []byte(strings.Repeat("d", 20))}, packets)
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+const logSuppressedName = "httpserver_log_suppressed_total"
+
+// suppressedCollector 把日志采样丢弃的累计条数导出为counter指标
+type suppressedCollector struct {
+	desc   *prometheus.Desc
+	counts func() map[string]uint64
+}
+
+func (c *suppressedCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *suppressedCollector) Collect(ch chan<- prometheus.Metric) {
+	for key, n := range c.counts() {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.CounterValue, float64(n), key)
+	}
+}
+
+// RegisterLogSuppressed 注册日志因采样或排除而未输出的条数。
+// source 区分日志的来源（如 logger、access），counts 返回各消息或路由的累计条数。
+func RegisterLogSuppressed(source string, counts func() map[string]uint64) {
+	LoadRegistry().MustRegister(&suppressedCollector{
+		desc: namedDesc(logSuppressedName, prometheus.NewDesc(
+			logSuppressedName,
+			"The total number of log events suppressed by sampling or exclusion.",
+			[]string{"key"},
+			prometheus.Labels{"source": source},
+		)),
+		counts: counts,
+	})
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"sync"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/logger"
+)
+
+// AccessLogOptions 访问日志的配置
+type AccessLogOptions struct {
+	Exclude  []string               `mapstructure:"exclude"`  // 不记录访问日志的路由，如探针的 /healthz 和 /readyz
+	Sampling logger.SamplingOptions `mapstructure:"sampling"` // 按路由采样
+}
+
+// 访问日志的排除和采样设定，启动时由 InitAccessLog 设定
+var accessLog = struct {
+	exclude  map[string]bool
+	sampler  *logger.Sampler
+	mu       sync.Mutex
+	excluded map[string]uint64 // 各路由因排除而未记录的条数
+}{
+	excluded: map[string]uint64{},
+}
+
+// InitAccessLog 设定访问日志的排除路由和采样，采样的配置错误时返回错误
+func InitAccessLog(opts AccessLogOptions) error {
+	sampler, err := logger.NewSampler(opts.Sampling)
+	if err != nil {
+		return err
+	}
+	accessLog.exclude = make(map[string]bool, len(opts.Exclude))
+	for _, route := range opts.Exclude {
+		accessLog.exclude[route] = true
+	}
+	accessLog.sampler = sampler
+	return nil
+}
+
+// AccessLogSuppressed 各路由未记录访问日志的累计条数（含排除和采样）
+func AccessLogSuppressed() map[string]uint64 {
+	counts := accessLog.sampler.Suppressed()
+
+	accessLog.mu.Lock()
+	defer accessLog.mu.Unlock()
+	for route, n := range accessLog.excluded {
+		counts[route] += n
+	}
+	return counts
+}
+
+// shouldLogAccess 判断该路由的这次访问是否记录日志
+func shouldLogAccess(route string) bool {
+	if accessLog.exclude[route] {
+		accessLog.mu.Lock()
+		accessLog.excluded[route]++
+		accessLog.mu.Unlock()
+		return false
+	}
+	return accessLog.sampler.Allow(route)
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/logger"
+	"github.com/kabacloud/cloudnativehomework4-module10/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnit_responseLogAccess(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	saved := log.Writer()
+	log.SetOutput(&buf)
+	defer log.SetOutput(saved)
+	defer func() { _ = InitAccessLog(AccessLogOptions{}) }()
+
+	assert.NoError(InitAccessLog(AccessLogOptions{
+		Exclude: []string{"/healthz"},
+		// /items/ 每分钟只记录第1条（之后每1000条记录一条）
+		Sampling: logger.SamplingOptions{Strategy: "first", First: 1, Thereafter: 1000, Period: time.Minute, Keys: []string{"/items/"}},
+	}))
+	metrics.RegisterLogSuppressed("access", AccessLogSuppressed)
+
+	ok := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	serve := func(route, path string) {
+		ResponseLog(route, ok).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	serve("/healthz", "/healthz")
+	serve("/healthz", "/healthz")
+	// 路径不同也按注册的路由计数
+	for i := 0; i < 3; i++ {
+		serve("/items/", "/items/"+strings.Repeat("x", i+1))
+	}
+	serve("/run", "/run?token=secret&q=1")
+
+	out := buf.String()
+	assert.NotContains(out, "/healthz")
+	assert.Contains(out, "url:/items/x\n")
+	assert.NotContains(out, "url:/items/xx")
+	// 查询参数按日志的脱敏规则替换
+	assert.Contains(out, "url:/run?token=%5BREDACTED%5D&q=1")
+	assert.NotContains(out, "secret")
+
+	assert.Equal(map[string]uint64{"/healthz": 2, "/items/": 2}, AccessLogSuppressed())
+	assert.NoError(testutil.GatherAndCompare(metrics.LoadRegistry(), strings.NewReader(`
+# HELP httpserver_log_suppressed_total The total number of log events suppressed by sampling or exclusion.
+# TYPE httpserver_log_suppressed_total counter
+httpserver_log_suppressed_total{key="/healthz",source="access"} 2
+httpserver_log_suppressed_total{key="/items/",source="access"} 2
+`), "httpserver_log_suppressed_total"))
+}
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/auth"
+)
+
+// Auth 按配置进行Basic认证或Bearer令牌认证，都未设定时直接通过。用于 /metrics 和 /admin 等管理用的路由
+func Auth(opts auth.Options, next http.Handler) http.Handler {
+	if !opts.Enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !opts.Authorize(r) {
+			w.Header().Set("WWW-Authenticate", opts.Challenge())
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,295 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/auth"
+	"github.com/kabacloud/cloudnativehomework4-module10/metrics"
+	"github.com/kabacloud/cloudnativehomework4-module10/protocol"
+	"github.com/kabacloud/cloudnativehomework4-module10/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 延时的分布
+const (
+	LatencyFixed   = "fixed"   // 固定为 fixed
+	LatencyUniform = "uniform" // min 到 max 之间的均匀分布
+	LatencyNormal  = "normal"  // 均值 mean、标准差 stddev 的正态分布，小于0时为0
+)
+
+// 针对性测试用的请求头，chaos.headers 为 true 时有效，优先于路由的设定且必定生效
+const (
+	ChaosLatencyHeader   = "X-Chaos-Latency"   // 延时，如 500ms
+	ChaosErrorHeader     = "X-Chaos-Error"     // 返回的状态码（400~599），如 503
+	ChaosAbortHeader     = "X-Chaos-Abort"     // 为 true 时中断连接
+	ChaosBandwidthHeader = "X-Chaos-Bandwidth" // 应答的带宽，单位字节/秒
+)
+
+// 带宽限制时每次写入的间隔
+const throttleInterval = 100 * time.Millisecond
+
+// 请求头指定的延时的上限和带宽的下限的默认值，避免一个请求长时间占用处理的协程
+const (
+	defaultChaosMaxLatency   = 10 * time.Second
+	defaultChaosMinBandwidth = 1024
+)
+
+// ChaosOptions 故障注入的配置
+type ChaosOptions struct {
+	Enabled bool                 `mapstructure:"enabled" json:"enabled"` // 是否注入故障，可通过 /admin/chaos 在运行时切换
+	Headers bool                 `mapstructure:"headers" json:"headers"` // 是否接受 X-Chaos-* 请求头指定的故障
+	Routes  map[string]ChaosRule `mapstructure:"routes" json:"routes"`   // 按路由（注册时的模式）设定的故障
+	Admin   auth.Options         `mapstructure:"admin" json:"-"`         // /admin/chaos 的认证，都未设定时不注册 /admin/chaos
+	// 请求头指定的延时的上限，默认10s，超过时返回400。只在启动时读取，/admin/chaos 不能修改
+	MaxLatency time.Duration `mapstructure:"maxlatency" json:"-"`
+	// 请求头指定的带宽（0即不限制除外）的下限，单位字节/秒，默认1024，低于时返回400。只在启动时读取
+	MinBandwidth int `mapstructure:"minbandwidth" json:"-"`
+}
+
+// ChaosRule 单个路由的故障
+type ChaosRule struct {
+	Latency      ChaosLatency `mapstructure:"latency" json:"latency"`           // 处理前的延时
+	ErrorPercent float64      `mapstructure:"errorpercent" json:"errorpercent"` // 返回错误的比例（0~100）
+	ErrorStatus  int          `mapstructure:"errorstatus" json:"errorstatus"`   // 返回错误时的状态码（400~599），默认500
+	AbortPercent float64      `mapstructure:"abortpercent" json:"abortpercent"` // 中断连接的比例（0~100）
+	Bandwidth    int          `mapstructure:"bandwidth" json:"bandwidth"`       // 应答的带宽，单位字节/秒，为0时不限制
+}
+
+// ChaosLatency 延时的分布
+type ChaosLatency struct {
+	Distribution string        `mapstructure:"distribution"` // fixed/uniform/normal，为空时不延时
+	Fixed        time.Duration `mapstructure:"fixed"`        // fixed：延时
+	Min          time.Duration `mapstructure:"min"`          // uniform：最小值
+	Max          time.Duration `mapstructure:"max"`          // uniform：最大值
+	Mean         time.Duration `mapstructure:"mean"`         // normal：均值
+	StdDev       time.Duration `mapstructure:"stddev"`       // normal：标准差
+}
+
+// MarshalJSON 时间以 500ms 等字符串输出，/admin/chaos 的输出可以直接作为设定使用
+func (l ChaosLatency) MarshalJSON() ([]byte, error) {
+	out := map[string]string{}
+	if l.Distribution != "" {
+		out["distribution"] = l.Distribution
+	}
+	for k, d := range map[string]time.Duration{"fixed": l.Fixed, "min": l.Min, "max": l.Max, "mean": l.Mean, "stddev": l.StdDev} {
+		if d != 0 {
+			out[k] = d.String()
+		}
+	}
+	return json.Marshal(out)
+}
+
+// 当前生效的故障设定，启动时由 InitChaos 设定，运行时由 SetChaos 替换
+var chaos = struct {
+	mu           sync.RWMutex
+	opts         ChaosOptions
+	recorder     protocol.MetricsRecorder
+	maxLatency   time.Duration // 请求头指定的延时的上限
+	minBandwidth int           // 请求头指定的带宽的下限
+}{maxLatency: defaultChaosMaxLatency, minBandwidth: defaultChaosMinBandwidth}
+
+// InitChaos 设定故障注入，注入的延时以 metrics.SleepDurationName 记录到recorder
+func InitChaos(opts ChaosOptions, recorder protocol.MetricsRecorder) error {
+	if opts.MaxLatency < 0 || opts.MinBandwidth < 0 {
+		return fmt.Errorf("chaos maxlatency and minbandwidth must not be negative")
+	}
+	if err := SetChaos(opts); err != nil {
+		return err
+	}
+	chaos.mu.Lock()
+	chaos.recorder = recorder
+	chaos.maxLatency, chaos.minBandwidth = defaultChaosMaxLatency, defaultChaosMinBandwidth
+	if opts.MaxLatency > 0 {
+		chaos.maxLatency = opts.MaxLatency
+	}
+	if opts.MinBandwidth > 0 {
+		chaos.minBandwidth = opts.MinBandwidth
+	}
+	chaos.mu.Unlock()
+	return nil
+}
+
+// SetChaos 在运行时替换故障设定，认证和请求头的限制保持不变
+func SetChaos(opts ChaosOptions) error {
+	for route, rule := range opts.Routes {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("chaos route %s: %w", route, err)
+		}
+	}
+	chaos.mu.Lock()
+	defer chaos.mu.Unlock()
+	opts.Admin = chaos.opts.Admin
+	chaos.opts = opts
+	return nil
+}
+
+// ChaosState 当前的故障设定
+func ChaosState() ChaosOptions {
+	chaos.mu.RLock()
+	defer chaos.mu.RUnlock()
+	return chaos.opts
+}
+
+// validate 检查比例、状态码和延时的分布
+func (c ChaosRule) validate() error {
+	if c.ErrorPercent < 0 || c.ErrorPercent > 100 || c.AbortPercent < 0 || c.AbortPercent > 100 {
+		return fmt.Errorf("percent must be between 0 and 100")
+	}
+	if c.ErrorStatus != 0 && !errorStatus(c.ErrorStatus) {
+		return fmt.Errorf("error status %d must be between 400 and 599", c.ErrorStatus)
+	}
+	if c.Bandwidth < 0 {
+		return fmt.Errorf("bandwidth must not be negative")
+	}
+	switch c.Latency.Distribution {
+	case "", LatencyFixed, LatencyNormal:
+	case LatencyUniform:
+		if c.Latency.Max < c.Latency.Min {
+			return fmt.Errorf("uniform latency needs min <= max")
+		}
+	default:
+		return fmt.Errorf("latency distribution %q not supported", c.Latency.Distribution)
+	}
+	return nil
+}
+
+// sample 按分布取得一次延时
+func (l ChaosLatency) sample() time.Duration {
+	var d time.Duration
+	switch l.Distribution {
+	case LatencyFixed:
+		d = l.Fixed
+	case LatencyUniform:
+		d = l.Min + time.Duration(rand.Float64()*float64(l.Max-l.Min))
+	case LatencyNormal:
+		d = l.Mean + time.Duration(rand.NormFloat64()*float64(l.StdDev))
+	}
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// Chaos 按路由的设定和 X-Chaos-* 请求头注入延时、错误、连接中断和带宽限制。
+// route 为注册路由时的模式，未启用时直接通过。请求头指定的延时超过上限或带宽低于下限时返回400
+func Chaos(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chaos.mu.RLock()
+		opts, recorder := chaos.opts, chaos.recorder
+		maxLatency, minBandwidth := chaos.maxLatency, chaos.minBandwidth
+		chaos.mu.RUnlock()
+		if !opts.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rule, ok := opts.Routes[route]
+		latency := time.Duration(-1)
+		if ok {
+			latency = rule.Latency.sample()
+		}
+		abort := ok && percent(rule.AbortPercent)
+		status := 0
+		if ok && percent(rule.ErrorPercent) {
+			status = rule.ErrorStatus
+			if status == 0 {
+				status = http.StatusInternalServerError
+			}
+		}
+		bandwidth := rule.Bandwidth
+		if opts.Headers {
+			if v := r.Header.Get(ChaosLatencyHeader); v != "" {
+				d, err := time.ParseDuration(v)
+				if err != nil || d < 0 || d > maxLatency {
+					chaosError(w, r, route, http.StatusBadRequest, fmt.Sprintf("%s must be between 0s and %s", ChaosLatencyHeader, maxLatency))
+					return
+				}
+				latency = d
+			}
+			if s, err := strconv.Atoi(r.Header.Get(ChaosErrorHeader)); err == nil && errorStatus(s) {
+				status = s
+			}
+			if b, err := strconv.ParseBool(r.Header.Get(ChaosAbortHeader)); err == nil {
+				abort = b
+			}
+			if v := r.Header.Get(ChaosBandwidthHeader); v != "" {
+				b, err := strconv.Atoi(v)
+				if err != nil || b < 0 || (b > 0 && b < minBandwidth) {
+					chaosError(w, r, route, http.StatusBadRequest, fmt.Sprintf("%s must be 0 or at least %d", ChaosBandwidthHeader, minBandwidth))
+					return
+				}
+				bandwidth = b
+			}
+		}
+
+		if latency >= 0 {
+			_, span := tracing.Tracer().Start(r.Context(), "sleep", trace.WithAttributes(attribute.Float64("sleep.duration", latency.Seconds())))
+			time.Sleep(latency)
+			span.End()
+			if recorder != nil {
+				recorder.ObserveHistogram(r.Context(), metrics.SleepDurationName, latency.Seconds(), nil)
+			}
+		}
+		if abort {
+			// 标准库在处理函数以 ErrAbortHandler panic 时中断连接且不记录日志，
+			// 内层的 ResponseLog 不会执行，所以在这里输出访问日志；请求数和span由外层的 Metrics 和 Tracing 记录
+			logAccess(route, r, metrics.StatusAborted)
+			panic(http.ErrAbortHandler)
+		}
+		if status != 0 {
+			chaosError(w, r, route, status, http.StatusText(status))
+			return
+		}
+		if bandwidth > 0 {
+			w = &throttledWriter{ResponseWriter: w, chunk: max(bandwidth*int(throttleInterval)/int(time.Second), 1)}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// chaosError 不执行处理函数而返回错误。内层的 ResponseLog 不会执行，所以在这里输出访问日志
+func chaosError(w http.ResponseWriter, r *http.Request, route string, status int, msg string) {
+	http.Error(w, msg, status)
+	logAccess(route, r, status)
+}
+
+// errorStatus 是否为表示错误的状态码（4xx/5xx）
+func errorStatus(status int) bool {
+	return status >= 400 && status <= 599
+}
+
+// percent 以 p% 的概率返回true
+func percent(p float64) bool {
+	return p > 0 && rand.Float64()*100 < p
+}
+
+// throttledWriter 每隔 throttleInterval 写入 chunk 字节以限制带宽
+type throttledWriter struct {
+	http.ResponseWriter
+	chunk int
+}
+
+func (t *throttledWriter) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		n := min(len(b), t.chunk)
+		m, err := t.ResponseWriter.Write(b[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		if f, ok := t.ResponseWriter.(http.Flusher); ok {
+			f.Flush()
+		}
+		b = b[n:]
+		time.Sleep(throttleInterval)
+	}
+	return written, nil
+}
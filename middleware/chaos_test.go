@@ -0,0 +1,211 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/metrics"
+	"github.com/kabacloud/cloudnativehomework4-module10/tracing"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// withChaos 测试期间替换故障设定
+func withChaos(t *testing.T, opts ChaosOptions) *metrics.MemoryRecorder {
+	saved := ChaosState()
+	m := metrics.NewMemoryRecorder()
+	assert.NoError(t, InitChaos(opts, m))
+	t.Cleanup(func() { _ = InitChaos(saved, nil) })
+	return m
+}
+
+func TestUnit_chaosRoutes(t *testing.T) {
+	assert := assert.New(t)
+
+	m := withChaos(t, ChaosOptions{Enabled: true, Routes: map[string]ChaosRule{
+		"/slow":   {Latency: ChaosLatency{Distribution: LatencyFixed, Fixed: 50 * time.Millisecond}},
+		"/broken": {ErrorPercent: 100, ErrorStatus: http.StatusServiceUnavailable},
+	}})
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("ok")) })
+
+	start := time.Now()
+	res := httptest.NewRecorder()
+	Chaos("/slow", ok).ServeHTTP(res, httptest.NewRequest("GET", "/slow", nil))
+	assert.True(time.Since(start) >= 50*time.Millisecond)
+	assert.Equal("ok", res.Body.String())
+	assert.Equal([]float64{0.05}, m.Observations(metrics.SleepDurationName, nil))
+
+	res = httptest.NewRecorder()
+	Chaos("/broken", ok).ServeHTTP(res, httptest.NewRequest("GET", "/broken", nil))
+	assert.Equal(http.StatusServiceUnavailable, res.Code)
+
+	// 没有设定的路由和未启用时直接通过
+	res = httptest.NewRecorder()
+	Chaos("/other", ok).ServeHTTP(res, httptest.NewRequest("GET", "/other", nil))
+	assert.Equal(http.StatusOK, res.Code)
+
+	opts := ChaosState()
+	opts.Enabled = false
+	assert.NoError(SetChaos(opts))
+	res = httptest.NewRecorder()
+	Chaos("/broken", ok).ServeHTTP(res, httptest.NewRequest("GET", "/broken", nil))
+	assert.Equal(http.StatusOK, res.Code)
+}
+
+func TestUnit_chaosHeaders(t *testing.T) {
+	assert := assert.New(t)
+
+	withChaos(t, ChaosOptions{Enabled: true, Headers: true, MaxLatency: time.Second, MinBandwidth: 100})
+	body := strings.Repeat("x", 30)
+	handler := Chaos("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte(body)) }))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(ChaosErrorHeader, "418")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(http.StatusTeapot, res.Code)
+
+	// 100字节/秒时每100ms写入10字节，30字节分3次写入
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(ChaosBandwidthHeader, "100")
+	res = httptest.NewRecorder()
+	start := time.Now()
+	handler.ServeHTTP(res, req)
+	assert.True(time.Since(start) >= 3*throttleInterval)
+	assert.Equal(body, res.Body.String())
+
+	// 4xx/5xx以外的状态码不是错误，忽略
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(ChaosErrorHeader, "204")
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(http.StatusOK, res.Code)
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(ChaosAbortHeader, "true")
+	assert.PanicsWithValue(http.ErrAbortHandler, func() { handler.ServeHTTP(httptest.NewRecorder(), req) })
+
+	// 超过上限的延时、低于下限的带宽和无法解析的值返回400
+	for header, value := range map[string]string{
+		ChaosLatencyHeader:   "2s",
+		ChaosBandwidthHeader: "99",
+	} {
+		for _, v := range []string{value, "-1", "x"} {
+			req = httptest.NewRequest("GET", "/", nil)
+			req.Header.Set(header, v)
+			res = httptest.NewRecorder()
+			start = time.Now()
+			handler.ServeHTTP(res, req)
+			assert.Equal(http.StatusBadRequest, res.Code, header+": "+v)
+			assert.True(time.Since(start) < time.Second)
+		}
+	}
+	assert.Error(InitChaos(ChaosOptions{MaxLatency: -time.Second}, nil))
+
+	// 不接受请求头时忽略
+	opts := ChaosState()
+	opts.Headers = false
+	assert.NoError(SetChaos(opts))
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(ChaosErrorHeader, "500")
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(http.StatusOK, res.Code)
+}
+
+func TestUnit_chaosLatency(t *testing.T) {
+	assert := assert.New(t)
+
+	uniform := ChaosLatency{Distribution: LatencyUniform, Min: 10 * time.Millisecond, Max: 20 * time.Millisecond}
+	normal := ChaosLatency{Distribution: LatencyNormal, Mean: 10 * time.Millisecond, StdDev: time.Second}
+	for i := 0; i < 100; i++ {
+		d := uniform.sample()
+		assert.True(d >= 10*time.Millisecond && d <= 20*time.Millisecond, d)
+		assert.True(normal.sample() >= 0)
+	}
+	assert.Equal(5*time.Millisecond, ChaosLatency{Distribution: LatencyFixed, Fixed: 5 * time.Millisecond}.sample())
+
+	assert.Error(SetChaos(ChaosOptions{Routes: map[string]ChaosRule{"/": {Latency: ChaosLatency{Distribution: "pareto"}}}}))
+	assert.Error(SetChaos(ChaosOptions{Routes: map[string]ChaosRule{"/": {ErrorPercent: 120}}}))
+	assert.Error(SetChaos(ChaosOptions{Routes: map[string]ChaosRule{"/": {Latency: uniform, ErrorStatus: 42}}}))
+	assert.Error(SetChaos(ChaosOptions{Routes: map[string]ChaosRule{"/": {ErrorStatus: http.StatusOK}}}))
+	assert.NoError(SetChaos(ChaosOptions{Routes: map[string]ChaosRule{"/": {ErrorStatus: http.StatusTooManyRequests}}}))
+}
+
+func TestUnit_chaosAbortRecorded(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	saved := log.Writer()
+	log.SetOutput(&buf)
+	defer log.SetOutput(saved)
+
+	exporter := tracetest.NewInMemoryExporter()
+	p, err := tracing.StartWithExporter(exporter, tracing.Options{})
+	assert.NoError(err)
+	defer p.Shutdown(context.Background())
+
+	r := withMetrics(t)
+	withChaos(t, ChaosOptions{Enabled: true, Routes: map[string]ChaosRule{"/abort": {AbortPercent: 100}}})
+	handler := Tracing("/abort", Metrics("/abort", Chaos("/abort", ResponseLog("/abort", http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})))))
+
+	// 中断连接也要计入请求数、span和访问日志
+	assert.PanicsWithValue(http.ErrAbortHandler, func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/abort", nil))
+	})
+
+	families, err := r.Gather()
+	assert.NoError(err)
+	var aborted float64
+	for _, f := range families {
+		if f.GetName() != "httpserver_http_requests_total" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["route"] == "/abort" && labels["status_class"] == metrics.StatusClassAborted {
+				aborted += m.GetCounter().GetValue()
+			}
+		}
+	}
+	assert.Equal(1.0, aborted)
+
+	assert.NoError(p.ForceFlush(context.Background()))
+	spans := exporter.GetSpans()
+	if assert.NotEmpty(spans) {
+		server := spans[len(spans)-1]
+		assert.Equal("GET /abort", server.Name)
+		assert.Equal(codes.Error, server.Status.Code)
+	}
+	assert.Contains(buf.String(), "statusCode:0 url:/abort aborted")
+}
+
+func TestUnit_chaosErrorLogged(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	saved := log.Writer()
+	log.SetOutput(&buf)
+	defer log.SetOutput(saved)
+
+	withChaos(t, ChaosOptions{Enabled: true, Routes: map[string]ChaosRule{"/broken": {ErrorPercent: 100, ErrorStatus: http.StatusBadGateway}}})
+	called := false
+	handler := Chaos("/broken", ResponseLog("/broken", http.HandlerFunc(func(http.ResponseWriter, *http.Request) { called = true })))
+
+	// 注入的错误不执行处理函数，也要输出访问日志
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("GET", "/broken", nil))
+	assert.Equal(http.StatusBadGateway, res.Code)
+	assert.False(called)
+	assert.Contains(buf.String(), "statusCode:502 url:/broken")
+}
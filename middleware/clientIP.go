@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIPOptions 客户端IP的识别
+type ClientIPOptions struct {
+	TrustedProxies []string `mapstructure:"trustedproxies"` // 可信的代理（Ingress、服务网格等）的CIDR或IP，为空时不采用 X-Forwarded-For 和 X-Real-IP
+}
+
+// 可信的代理，启动时由 InitClientIP 设定
+var trustedProxies []*net.IPNet
+
+// InitClientIP 设定可信的代理
+func InitClientIP(opts ClientIPOptions) error {
+	nets := make([]*net.IPNet, 0, len(opts.TrustedProxies))
+	for _, cidr := range opts.TrustedProxies {
+		cidr = strings.TrimSpace(cidr)
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("trusted proxy %q: %w", cidr, err)
+		}
+		nets = append(nets, n)
+	}
+	trustedProxies = nets
+	return nil
+}
+
+// ClientIP 客户端的IP。连接的远端是可信的代理时，取 X-Forwarded-For 中从右往左第一个不可信的地址，
+// 没有 X-Forwarded-For 时取 X-Real-IP；否则取连接的远端地址。
+// X-Forwarded-For 左侧的地址可以由客户端任意伪造，所以不取第一个地址
+func ClientIP(r *http.Request) string {
+	peer := stripPort(r.RemoteAddr)
+	if !trusted(peer) {
+		return peer
+	}
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		ip := peer
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := stripPort(strings.TrimSpace(hops[i]))
+			if hop == "" {
+				continue
+			}
+			ip = hop
+			if !trusted(hop) {
+				break
+			}
+		}
+		return ip
+	}
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+		return stripPort(ip)
+	}
+	return peer
+}
+
+// trusted 地址是否为可信的代理
+func trusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// stripPort 去掉地址中的端口，没有端口时原样返回
+func stripPort(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.Trim(addr, "[]")
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnit_clientIP(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { trustedProxies = nil }()
+
+	// 没有可信的代理时不采用请求头
+	assert.NoError(InitClientIP(ClientIPOptions{}))
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:51234"
+	r.Header.Set("X-Real-IP", "198.51.100.2")
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	assert.Equal("10.0.0.1", ClientIP(r))
+
+	assert.NoError(InitClientIP(ClientIPOptions{TrustedProxies: []string{"10.0.0.0/8", "2001:db8::1"}}))
+	r.Header.Del("X-Forwarded-For")
+	assert.Equal("198.51.100.2", ClientIP(r))
+
+	// 取从右往左第一个不可信的地址，客户端伪造的左侧地址不采用
+	r.Header.Set("X-Forwarded-For", "1.2.3.4, 203.0.113.7, 10.0.0.2")
+	assert.Equal("203.0.113.7", ClientIP(r))
+
+	// 多个请求头合并处理
+	r.Header.Set("X-Forwarded-For", "1.2.3.4")
+	r.Header.Add("X-Forwarded-For", "203.0.113.8")
+	assert.Equal("203.0.113.8", ClientIP(r))
+
+	// 全部是可信的代理时取最左侧的地址
+	r.Header.Set("X-Forwarded-For", "[2001:db8::1]:443, 10.0.0.3")
+	assert.Equal("2001:db8::1", ClientIP(r))
+
+	// 远端不是可信的代理
+	r.RemoteAddr = "192.0.2.9:1234"
+	assert.Equal("192.0.2.9", ClientIP(r))
+
+	assert.Error(InitClientIP(ClientIPOptions{TrustedProxies: []string{"10.0.0.0/33"}}))
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/metrics"
+	"github.com/kabacloud/cloudnativehomework4-module10/protocol"
+	"github.com/kabacloud/cloudnativehomework4-module10/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 记录请求指标的recorder，由 InitMetrics 设定，未设定时不记录
+var metricsRecorder protocol.MetricsRecorder = metrics.NopRecorder{}
+
+// InitMetrics 设定记录请求指标的recorder，通常为同时输出到Prometheus、OTLP、StatsD等后端的 metrics.Recorders
+func InitMetrics(recorder protocol.MetricsRecorder) {
+	if recorder == nil {
+		recorder = metrics.NopRecorder{}
+	}
+	metricsRecorder = recorder
+}
+
+// Metrics 记录请求数、处理时间、请求和应答的大小以及处理中的请求数。
+// route 为注册路由时的模式，避免按实际URL区分导致时间序列无限增长。
+// 处理时间等直方图附带trace ID和请求ID作为exemplar，trace ID取自 Tracing 生成的span。
+// 处理中panic（如故障注入中断连接）时以 metrics.StatusAborted 记录后继续panic。
+func Metrics(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := metricsRecorder
+		done := metrics.RequestStarted(r.Context(), recorder, route, r.Method)
+		defer done()
+
+		r = r.WithContext(metrics.ContextWithExemplar(r.Context(), exemplarLabels(r)))
+
+		start := time.Now()
+		wRecorder := &statusRecorder{
+			ResponseWriter: w,
+			Status:         http.StatusOK,
+		}
+		requestSize := r.ContentLength
+		if requestSize < 0 {
+			requestSize = 0
+		}
+		defer func() {
+			if v := recover(); v != nil {
+				metrics.ObserveRequest(r.Context(), recorder, route, r.Method, metrics.StatusAborted, time.Since(start), requestSize, wRecorder.Bytes)
+				panic(v)
+			}
+		}()
+		next.ServeHTTP(wRecorder, r)
+
+		metrics.ObserveRequest(r.Context(), recorder, route, r.Method, wRecorder.Status, time.Since(start), requestSize, wRecorder.Bytes)
+	})
+}
+
+// exemplarLabels 用trace ID和请求ID作为exemplar的标签
+func exemplarLabels(r *http.Request) prometheus.Labels {
+	labels := prometheus.Labels{}
+	if traceID := tracing.TraceID(r.Context()); traceID != "" {
+		labels["trace_id"] = traceID
+	}
+	if requestID := RequestIDFromContext(r.Context()); requestID != "" {
+		labels["request_id"] = requestID
+	}
+	return labels
+}
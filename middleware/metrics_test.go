@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+// routeGatherer 只保留route标签为指定路由的时间序列，避免其他测试记录的请求影响比较
+func routeGatherer(g prometheus.Gatherer, route string) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := g.Gather()
+		var filtered []*dto.MetricFamily
+		for _, f := range families {
+			var ms []*dto.Metric
+			for _, m := range f.GetMetric() {
+				for _, l := range m.GetLabel() {
+					if l.GetName() == "route" && l.GetValue() == route {
+						ms = append(ms, m)
+					}
+				}
+			}
+			if len(ms) > 0 {
+				f.Metric = ms
+				filtered = append(filtered, f)
+			}
+		}
+		return filtered, err
+	})
+}
+
+// withMetrics 测试期间把请求指标记录到 LoadRegistry 的注册表
+func withMetrics(t *testing.T) *prometheus.Registry {
+	r := metrics.LoadRegistry()
+	InitMetrics(metrics.NewPrometheusRecorder(r))
+	t.Cleanup(func() { InitMetrics(nil) })
+	return r
+}
+
+func TestUnit_metrics(t *testing.T) {
+	assert := assert.New(t)
+
+	g := routeGatherer(withMetrics(t), "/x")
+	handler := Metrics("/x", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 处理中的请求数
+		assert.NoError(testutil.GatherAndCompare(g, strings.NewReader(`
+# HELP httpserver_http_requests_in_flight The number of HTTP requests currently being served.
+# TYPE httpserver_http_requests_in_flight gauge
+httpserver_http_requests_in_flight{method="POST",route="/x"} 1
+`), "httpserver_http_requests_in_flight"))
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(strings.Repeat("x", 500)))
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/x/123", strings.NewReader(strings.Repeat("x", 50))))
+
+	// 按路由模式而不是实际的URL记录
+	assert.NoError(testutil.GatherAndCompare(g, strings.NewReader(`
+# HELP httpserver_http_requests_in_flight The number of HTTP requests currently being served.
+# TYPE httpserver_http_requests_in_flight gauge
+httpserver_http_requests_in_flight{method="POST",route="/x"} 0
+# HELP httpserver_http_requests_total The total number of handled HTTP requests.
+# TYPE httpserver_http_requests_total counter
+httpserver_http_requests_total{method="POST",route="/x",status_class="4xx"} 1
+# HELP httpserver_http_request_size_bytes A histogram of the HTTP request body sizes in bytes.
+# TYPE httpserver_http_request_size_bytes histogram
+httpserver_http_request_size_bytes_bucket{method="POST",route="/x",status_class="4xx",le="100"} 1
+httpserver_http_request_size_bytes_bucket{method="POST",route="/x",status_class="4xx",le="1000"} 1
+httpserver_http_request_size_bytes_bucket{method="POST",route="/x",status_class="4xx",le="10000"} 1
+httpserver_http_request_size_bytes_bucket{method="POST",route="/x",status_class="4xx",le="100000"} 1
+httpserver_http_request_size_bytes_bucket{method="POST",route="/x",status_class="4xx",le="1e+06"} 1
+httpserver_http_request_size_bytes_bucket{method="POST",route="/x",status_class="4xx",le="1e+07"} 1
+httpserver_http_request_size_bytes_bucket{method="POST",route="/x",status_class="4xx",le="1e+08"} 1
+httpserver_http_request_size_bytes_bucket{method="POST",route="/x",status_class="4xx",le="+Inf"} 1
+httpserver_http_request_size_bytes_sum{method="POST",route="/x",status_class="4xx"} 50
+httpserver_http_request_size_bytes_count{method="POST",route="/x",status_class="4xx"} 1
+# HELP httpserver_http_response_size_bytes A histogram of the HTTP response body sizes in bytes.
+# TYPE httpserver_http_response_size_bytes histogram
+httpserver_http_response_size_bytes_bucket{method="POST",route="/x",status_class="4xx",le="100"} 0
+httpserver_http_response_size_bytes_bucket{method="POST",route="/x",status_class="4xx",le="1000"} 1
+httpserver_http_response_size_bytes_bucket{method="POST",route="/x",status_class="4xx",le="10000"} 1
+httpserver_http_response_size_bytes_bucket{method="POST",route="/x",status_class="4xx",le="100000"} 1
+httpserver_http_response_size_bytes_bucket{method="POST",route="/x",status_class="4xx",le="1e+06"} 1
+httpserver_http_response_size_bytes_bucket{method="POST",route="/x",status_class="4xx",le="1e+07"} 1
+httpserver_http_response_size_bytes_bucket{method="POST",route="/x",status_class="4xx",le="1e+08"} 1
+httpserver_http_response_size_bytes_bucket{method="POST",route="/x",status_class="4xx",le="+Inf"} 1
+httpserver_http_response_size_bytes_sum{method="POST",route="/x",status_class="4xx"} 500
+httpserver_http_response_size_bytes_count{method="POST",route="/x",status_class="4xx"} 1
+`), "httpserver_http_requests_in_flight", "httpserver_http_requests_total", "httpserver_http_request_size_bytes", "httpserver_http_response_size_bytes"))
+
+	// 处理时间的总和不固定，只比较次数
+	families, err := g.Gather()
+	assert.NoError(err)
+	var durations uint64
+	for _, f := range families {
+		if f.GetName() == "httpserver_http_request_duration_seconds" {
+			for _, m := range f.GetMetric() {
+				durations += m.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	assert.Equal(uint64(1), durations)
+}
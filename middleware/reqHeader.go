@@ -1,22 +1,58 @@
 package middleware
 
 import (
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/kabacloud/cloudnativehomework4-module10/environment"
+	"github.com/kabacloud/cloudnativehomework4-module10/logger"
 )
 
+// 请求头带入应答的方式
+const (
+	HeaderEchoAll    = "all"    // 原样带入
+	HeaderEchoRedact = "redact" // 按日志的脱敏规则替换敏感的值后带入
+	HeaderEchoNone   = "none"   // 不带入
+)
+
+// RequestHeaderOptions 请求头的处理
+type RequestHeaderOptions struct {
+	Echo string `mapstructure:"echo"` // 请求头带入应答的方式：all（默认）/redact/none
+}
+
+// 请求头带入应答的方式，启动时由 InitRequestHeader 设定
+var headerEcho = HeaderEchoAll
+
+// InitRequestHeader 设定请求头带入应答的方式
+func InitRequestHeader(opts RequestHeaderOptions) error {
+	switch opts.Echo {
+	case "":
+		headerEcho = HeaderEchoAll
+	case HeaderEchoAll, HeaderEchoRedact, HeaderEchoNone:
+		headerEcho = opts.Echo
+	default:
+		return fmt.Errorf("header echo %q not supported", opts.Echo)
+	}
+	return nil
+}
+
 func RequestHeader(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// 中间件的逻辑在这里实现,在执行传递进来的handler之前
 		// [作业要求]Request中的Header要带入Response中
 		for k, v := range r.Header {
 			if environment.IsLocalhost() {
-				log.Printf("%s:%s", k, v)
+				log.Printf("%s:%s", k, logger.Redact(k, strings.Join(v, ",")))
+			}
+			switch headerEcho {
+			case HeaderEchoAll:
+				w.Header().Set(k, v[0]) // 用Postman测试自定义request header时，如果值是空的话，服务接收到的值是空串不是nil，所以直接用v[0]取值而没有判断nil。
+			case HeaderEchoRedact:
+				w.Header().Set(k, logger.Redact(k, v[0]))
 			}
-			w.Header().Set(k, v[0]) // 用Postman测试自定义request header时，如果值是空的话，服务接收到的值是空串不是nil，所以直接用v[0]取值而没有判断nil。
 		}
 		// [作业要求]Response中带入环境变量VERSION的值
 		envVersion := os.Getenv("VERSION")
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnit_requestHeaderEcho(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { _ = InitRequestHeader(RequestHeaderOptions{}) }()
+
+	serve := func() http.Header {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Custom", "value")
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		RequestHeader(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(rec, req)
+		return rec.Header()
+	}
+
+	assert.NoError(InitRequestHeader(RequestHeaderOptions{}))
+	h := serve()
+	assert.Equal("value", h.Get("X-Custom"))
+	assert.Equal("Bearer secret", h.Get("Authorization"))
+	assert.Contains(h, "Version")
+
+	assert.NoError(InitRequestHeader(RequestHeaderOptions{Echo: HeaderEchoRedact}))
+	h = serve()
+	assert.Equal("value", h.Get("X-Custom"))
+	assert.NotContains(h.Get("Authorization"), "secret")
+
+	assert.NoError(InitRequestHeader(RequestHeaderOptions{Echo: HeaderEchoNone}))
+	h = serve()
+	assert.Empty(h.Get("X-Custom"))
+	assert.Empty(h.Get("Authorization"))
+	assert.Contains(h, "Version")
+
+	assert.Error(InitRequestHeader(RequestHeaderOptions{Echo: "some"}))
+}
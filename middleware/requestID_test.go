@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnit_requestID(t *testing.T) {
+	assert := assert.New(t)
+
+	serve := func(id string) (header, ctxID string) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if id != "" {
+			req.Header.Set(RequestIDHeader, id)
+		}
+		rec := httptest.NewRecorder()
+		RequestID(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			ctxID = RequestIDFromContext(r.Context())
+		})).ServeHTTP(rec, req)
+		return rec.Header().Get(RequestIDHeader), ctxID
+	}
+
+	// 符合格式的请求ID原样沿用
+	header, ctxID := serve("abc-123_X.y")
+	assert.Equal("abc-123_X.y", header)
+	assert.Equal("abc-123_X.y", ctxID)
+
+	// 没有、过长、含非UTF-8或其他字符时重新生成
+	for _, id := range []string{"", strings.Repeat("a", 65), "\xff\xfe", "a b", "id;drop"} {
+		header, ctxID := serve(id)
+		assert.Regexp(`^[0-9a-f]{32}$`, header, id)
+		assert.Equal(header, ctxID)
+	}
+}
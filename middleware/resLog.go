@@ -1,15 +1,20 @@
 package middleware
 
 import (
+	"fmt"
 	"log"
-	"net"
 	"net/http"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/logger"
+	"github.com/kabacloud/cloudnativehomework4-module10/metrics"
+	"github.com/kabacloud/cloudnativehomework4-module10/tracing"
 )
 
-// 为了记录response的statusCode而定义的结构体
+// 为了记录response的statusCode和应答大小而定义的结构体
 type statusRecorder struct {
 	http.ResponseWriter
 	Status int
+	Bytes  int64 // 已写入的应答体字节数
 }
 
 // 扩展了系统的http.ResponseWriter对象的WriteHeader方法，增加了记录statusCode的功能。
@@ -18,7 +23,15 @@ func (r *statusRecorder) WriteHeader(status int) {
 	r.ResponseWriter.WriteHeader(status)
 }
 
-func ResponseLog(next http.Handler) http.Handler {
+// 扩展了系统的http.ResponseWriter对象的Write方法，增加了记录应答大小的功能。
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.Bytes += int64(n)
+	return n, err
+}
+
+// ResponseLog 输出访问日志，按注册路由时的模式排除和采样，避免按请求路径无限增加采样的状态和指标的时间序列
+func ResponseLog(route string, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// 中间件的逻辑在这里实现,在执行传递进来的handler之前
 		// 如:验证权限
@@ -38,15 +51,32 @@ func ResponseLog(next http.Handler) http.Handler {
 		// w.Header().Set("VERSION", envVersion)
 
 		// [作业要求]取得IP后在标准输出中记录IP的返回状态码
-		ip, _, _ := net.SplitHostPort(getIP(r))
-		log.Printf("%s statusCode:%d url:%s", ip, wRecorder.Status, r.URL)
+		logAccess(route, r, wRecorder.Status)
 	})
 }
 
-func getIP(r *http.Request) string {
-	forwarded := r.Header.Get("X-FORWARDED-FOR")
-	if forwarded != "" {
-		return forwarded
+// logAccess 按路由的排除和采样设定输出一条访问日志，连接被中断时状态码为 metrics.StatusAborted。
+// URL的查询参数按日志的脱敏规则替换
+func logAccess(route string, r *http.Request, status int) {
+	if !shouldLogAccess(route) {
+		return
+	}
+	msg := fmt.Sprintf("%s statusCode:%d url:%s", ClientIP(r), status, logger.RedactURL(r.URL))
+	if status == metrics.StatusAborted {
+		msg += " " + metrics.StatusClassAborted
+	}
+	if requestID := RequestIDFromContext(r.Context()); requestID != "" {
+		msg += " requestID:" + requestID
+	}
+	if traceID := tracing.TraceID(r.Context()); traceID != "" {
+		msg += " traceID:" + traceID
+	}
+	log.Print(msg)
+}
+
+// Flush 带宽限制等需要分段输出时，把缓存的应答体发送给客户端
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
 	}
-	return r.RemoteAddr
 }
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/logger"
+	"github.com/kabacloud/cloudnativehomework4-module10/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing 从请求头的W3C traceparent/baggage继续上游的trace，为每个请求生成以路由命名的服务端span，
+// 并把span写入应答头的traceparent，以便客户端和日志、exemplar关联。
+// route 为注册路由时的模式，span名按语义约定为“方法 路由”。处理中panic（如中断连接）时span记为错误。
+// 处理函数通过 logger.LoggerFromContext 取得的Logger附带trace_id、span_id和request_id。
+func Tracing(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		propagator := otel.GetTextMapPropagator()
+		ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		attrs := []trace.SpanStartOption{
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(r.URL.Path),
+				semconv.UserAgentOriginal(r.UserAgent()),
+				semconv.ClientAddress(ClientIP(r)),
+			),
+		}
+		ctx, span := tracing.Tracer().Start(ctx, r.Method+" "+route, attrs...)
+		defer span.End()
+		var logAttrs []any
+		if sc := span.SpanContext(); sc.IsValid() {
+			logAttrs = append(logAttrs, "trace_id", sc.TraceID().String(), "span_id", sc.SpanID().String())
+		}
+		if requestID := RequestIDFromContext(ctx); requestID != "" {
+			span.SetAttributes(attribute.String("http.request.header.x-request-id", requestID))
+			logAttrs = append(logAttrs, "request_id", requestID)
+		}
+		if len(logAttrs) > 0 {
+			ctx = logger.ContextWithLogger(ctx, logger.LoggerFromContext(ctx).With(logAttrs...))
+		}
+
+		propagator.Inject(ctx, propagation.HeaderCarrier(w.Header()))
+		wRecorder := &statusRecorder{
+			ResponseWriter: w,
+			Status:         http.StatusOK,
+		}
+		defer func() {
+			if v := recover(); v != nil {
+				span.SetAttributes(attribute.Bool("http.response.aborted", true))
+				span.SetStatus(codes.Error, fmt.Sprint(v))
+				panic(v)
+			}
+		}()
+		next.ServeHTTP(wRecorder, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(wRecorder.Status), semconv.HTTPResponseBodySize(int(wRecorder.Bytes)))
+		if wRecorder.Status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(wRecorder.Status))
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/logger"
+	"github.com/kabacloud/cloudnativehomework4-module10/tracing"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestUnit_tracingLogger(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	saved := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	defer slog.SetDefault(saved)
+
+	exporter := tracetest.NewInMemoryExporter()
+	p, err := tracing.StartWithExporter(exporter, tracing.Options{})
+	assert.NoError(err)
+	defer p.Shutdown(context.Background())
+
+	// 处理函数取得的Logger附带span的trace ID、span ID和请求ID
+	handler := RequestID(Tracing("/x", http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		logger.LoggerFromContext(r.Context()).Info("handled")
+	})))
+	req := httptest.NewRequest(http.MethodGet, "/x", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]string
+	assert.NoError(json.Unmarshal(buf.Bytes(), &entry))
+	assert.NoError(p.ForceFlush(context.Background()))
+	spans := exporter.GetSpans()
+	if assert.Len(spans, 1) {
+		assert.Equal(spans[0].SpanContext.TraceID().String(), entry["trace_id"])
+		assert.Equal(spans[0].SpanContext.SpanID().String(), entry["span_id"])
+	}
+	assert.Equal("req-1", entry["request_id"])
+	assert.Equal("handled", entry["msg"])
+
+	// 没有经过 Tracing 时为默认的Logger
+	assert.Same(slog.Default(), logger.LoggerFromContext(context.Background()))
+}
@@ -0,0 +1,16 @@
+package protocol
+
+import "context"
+
+// MetricsRecorder 指标组件需要实现的协议。
+// 同一指标名的标签的键需保持一致，ctx 中带有trace ID等信息时可作为exemplar记录。
+type MetricsRecorder interface {
+	// AddCounter 计数器增加value（不能为负数）
+	AddCounter(ctx context.Context, name string, value float64, labels map[string]string)
+	// SetGauge 把仪表盘设为value
+	SetGauge(ctx context.Context, name string, value float64, labels map[string]string)
+	// AddGauge 仪表盘增加value（可以为负数）
+	AddGauge(ctx context.Context, name string, value float64, labels map[string]string)
+	// ObserveHistogram 直方图记录一个观测值
+	ObserveHistogram(ctx context.Context, name string, value float64, labels map[string]string)
+}
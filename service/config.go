@@ -0,0 +1,116 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/environment"
+	"github.com/kabacloud/cloudnativehomework4-module10/logger"
+	"github.com/kabacloud/cloudnativehomework4-module10/metrics"
+	"github.com/kabacloud/cloudnativehomework4-module10/middleware"
+	"github.com/kabacloud/cloudnativehomework4-module10/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+)
+
+// Config 服务的配置，对应配置文件中的各个节点
+type Config struct {
+	Environment   environment.ProfileOptions      `mapstructure:"environment"`   // 执行环境的配置
+	Log           logger.Options                  `mapstructure:"log"`           // 日志
+	AccessLog     middleware.AccessLogOptions     `mapstructure:"accesslog"`     // 访问日志
+	RequestHeader middleware.RequestHeaderOptions `mapstructure:"requestheader"` // 请求头
+	ClientIP      middleware.ClientIPOptions      `mapstructure:"clientip"`      // 客户端IP
+	Metrics       metrics.Options                 `mapstructure:"metrics"`       // 指标
+	Tracing       tracing.Options                 `mapstructure:"tracing"`       // 链路追踪
+	Chaos         middleware.ChaosOptions         `mapstructure:"chaos"`         // 故障注入
+	Runtime       environment.RuntimeOptions      `mapstructure:"runtime"`       // Go运行时
+}
+
+// 可以通过环境变量设定的认证信息，如 METRICS_AUTH_PASSWORD、CHAOS_ADMIN_BEARERTOKEN。
+// 配置文件中没有的键 viper.Unmarshal 不会从环境变量读取，所以需要逐个绑定
+var secretKeys = []string{
+	"metrics.auth.username", "metrics.auth.password", "metrics.auth.bearertoken",
+	"chaos.admin.username", "chaos.admin.password", "chaos.admin.bearertoken",
+}
+
+// BindEnv 以环境变量覆盖配置，键名中的.替换为_，如 metrics.auth.password 对应 METRICS_AUTH_PASSWORD
+func BindEnv() {
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+	for _, key := range secretKeys {
+		_ = viper.BindEnv(key)
+	}
+}
+
+// LoadConfig 读取配置，配置文件中没有设定的项目使用默认值，再以执行环境的配置覆盖。
+// HWENV不是已知的执行环境且没有设定fallback时返回错误
+func LoadConfig() (Config, error) {
+	cfg := Config{
+		Log: logger.Options{
+			Level:       "debug",
+			ServiceName: "httpserver",
+		},
+		Metrics: metrics.Options{
+			Collectors: metrics.CollectorOptions{Process: true, Go: true, Container: true},
+			// 请求方法等由客户端决定，默认限制每个指标的标签组合数
+			Cardinality: metrics.CardinalityOptions{Limit: 500},
+		},
+		// 默认按容器的内存上限设定GOMEMLIMIT，为协程栈等非堆内存预留10%
+		Runtime: environment.RuntimeOptions{AutoMemoryLimit: true, MemoryLimitHeadroom: 0.1},
+	}
+	if err := viper.Unmarshal(&cfg); err != nil {
+		return cfg, err
+	}
+	// 没有设定故障注入时，和以前一样为 /info 添加0-2秒的随机延时，环境变量设定的认证保持不变
+	if !viper.IsSet("chaos") {
+		admin := cfg.Chaos.Admin
+		cfg.Chaos = defaultChaos()
+		cfg.Chaos.Admin = admin
+	}
+	profile, err := environment.LoadProfile(cfg.Environment)
+	if err != nil {
+		return cfg, err
+	}
+	applyProfile(&cfg, profile)
+	return cfg, nil
+}
+
+// applyProfile 以执行环境的配置覆盖各节点的设定
+func applyProfile(cfg *Config, p environment.Profile) {
+	if p.LogLevel != "" {
+		cfg.Log.Level = p.LogLevel
+	}
+	if p.Chaos != nil {
+		cfg.Chaos.Enabled = *p.Chaos
+	}
+	if p.HeaderEcho != "" {
+		cfg.RequestHeader.Echo = p.HeaderEcho
+	}
+}
+
+// LoadRegistry 按配置加载指标的注册表，设定了SLO时一并注册SLO的指标。
+// 服务启动和生成告警规则、仪表盘时使用，以保证两者的指标一致
+func LoadRegistry(cfg Config) (*prometheus.Registry, *metrics.SLOTracker, error) {
+	r, err := metrics.LoadRegistryWithOptions(cfg.Metrics)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(cfg.Metrics.SLO.Objectives) == 0 {
+		return r, nil, nil
+	}
+	tracker, err := metrics.NewSLOTracker(cfg.Metrics.SLO)
+	if err != nil {
+		return nil, nil, err
+	}
+	r.MustRegister(tracker)
+	return r, tracker, nil
+}
+
+// defaultChaos 作业要求的 /info 的0-2秒随机延时
+func defaultChaos() middleware.ChaosOptions {
+	delay := middleware.ChaosRule{Latency: middleware.ChaosLatency{Distribution: middleware.LatencyUniform, Max: 2 * time.Second}}
+	return middleware.ChaosOptions{
+		Enabled: true,
+		Routes:  map[string]middleware.ChaosRule{"/info": delay, "/": delay},
+	}
+}
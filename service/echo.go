@@ -0,0 +1,173 @@
+package service
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/environment"
+	"github.com/kabacloud/cloudnativehomework4-module10/logger"
+	"github.com/kabacloud/cloudnativehomework4-module10/middleware"
+)
+
+// 回显的请求体的最大字节数，超过时不再读取，应答后关闭连接
+const maxEchoBody = 64 << 10
+
+// echoResponse /echo 回显的请求内容
+type echoResponse struct {
+	Method        string              `json:"method" yaml:"method"`
+	URL           string              `json:"url" yaml:"url"`
+	Proto         string              `json:"proto" yaml:"proto"`
+	Host          string              `json:"host" yaml:"host"`
+	Headers       map[string][]string `json:"headers" yaml:"headers"`
+	Query         map[string][]string `json:"query" yaml:"query"`
+	Body          string              `json:"body" yaml:"body"`
+	BodyEncoding  string              `json:"bodyEncoding,omitempty" yaml:"bodyEncoding,omitempty"` // 请求体不是UTF-8时为base64
+	BodySize      int64               `json:"bodySize" yaml:"bodySize"`                             // 截断时为Content-Length，未知时为-1
+	BodyTruncated bool                `json:"bodyTruncated" yaml:"bodyTruncated"`
+	TLS           *echoTLS            `json:"tls,omitempty" yaml:"tls,omitempty"`
+	RemoteAddr    string              `json:"remoteAddr" yaml:"remoteAddr"`
+	ClientIP      string              `json:"clientIP" yaml:"clientIP"`
+	RequestID     string              `json:"requestID,omitempty" yaml:"requestID,omitempty"`
+	Hostname      string              `json:"hostname" yaml:"hostname"`
+	Pod           environment.PodMeta `json:"pod" yaml:"pod"`
+}
+
+// echoTLS TLS连接的信息
+type echoTLS struct {
+	Version            string   `json:"version" yaml:"version"`
+	CipherSuite        string   `json:"cipherSuite" yaml:"cipherSuite"`
+	ServerName         string   `json:"serverName,omitempty" yaml:"serverName,omitempty"`
+	NegotiatedProtocol string   `json:"negotiatedProtocol,omitempty" yaml:"negotiatedProtocol,omitempty"`
+	PeerCertificates   []string `json:"peerCertificates,omitempty" yaml:"peerCertificates,omitempty"` // 客户端证书的Subject
+}
+
+// 以JSON、YAML或文本（按Accept请求头）回显收到的请求，用于调试Ingress和服务网格对请求的改写。
+// 请求头和查询参数中的认证信息等按日志的脱敏规则替换
+func echoHandler(w http.ResponseWriter, r *http.Request) {
+	varyAccept(w)
+	echo := newEchoResponse(w, r)
+
+	format := negotiate(r.Header.Get("Accept"), mediaJSON, mediaYAML, mediaText)
+	if format == mediaText {
+		w.Header().Set("Content-Type", mediaText+"; charset=utf-8")
+		writeEchoText(w, echo)
+		return
+	}
+	writeEncoded(w, format, echo)
+}
+
+// newEchoResponse 读取请求的内容，请求体只读取前 maxEchoBody 字节
+func newEchoResponse(w http.ResponseWriter, r *http.Request) echoResponse {
+	echo := echoResponse{
+		Method:     r.Method,
+		URL:        logger.RedactURL(r.URL),
+		Proto:      r.Proto,
+		Host:       r.Host,
+		Headers:    map[string][]string{},
+		Query:      logger.RedactQuery(r.URL.Query()),
+		RemoteAddr: r.RemoteAddr,
+		ClientIP:   middleware.ClientIP(r),
+		RequestID:  middleware.RequestIDFromContext(r.Context()),
+		Hostname:   environment.Hostname,
+		Pod:        environment.Pod,
+	}
+	for k, vs := range r.Header {
+		redacted := make([]string, len(vs))
+		for i, v := range vs {
+			redacted[i] = logger.Redact(k, v)
+		}
+		echo.Headers[k] = redacted
+	}
+
+	var body bytes.Buffer
+	n, err := io.Copy(&body, http.MaxBytesReader(w, r.Body, maxEchoBody))
+	echo.BodySize = n
+	// 超过上限时不读取剩余的部分，以Content-Length作为大小
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		echo.BodySize, echo.BodyTruncated = r.ContentLength, true
+	}
+	if utf8.Valid(body.Bytes()) {
+		echo.Body = body.String()
+	} else {
+		echo.Body, echo.BodyEncoding = base64.StdEncoding.EncodeToString(body.Bytes()), "base64"
+	}
+
+	if r.TLS != nil {
+		echo.TLS = &echoTLS{
+			Version:            tls.VersionName(r.TLS.Version),
+			CipherSuite:        tls.CipherSuiteName(r.TLS.CipherSuite),
+			ServerName:         r.TLS.ServerName,
+			NegotiatedProtocol: r.TLS.NegotiatedProtocol,
+		}
+		for _, cert := range r.TLS.PeerCertificates {
+			echo.TLS.PeerCertificates = append(echo.TLS.PeerCertificates, cert.Subject.String())
+		}
+	}
+	return echo
+}
+
+// writeEchoText 以 “名称: 值” 的文本输出，请求头和参数按名称排序
+func writeEchoText(w io.Writer, echo echoResponse) {
+	fmt.Fprintf(w, "%s %s %s\n", echo.Method, echo.URL, echo.Proto)
+	fmt.Fprintf(w, "Host: %s\n", echo.Host)
+	fmt.Fprintf(w, "Remote address: %s\n", echo.RemoteAddr)
+	fmt.Fprintf(w, "Client IP: %s\n", echo.ClientIP)
+	if echo.RequestID != "" {
+		fmt.Fprintf(w, "Request ID: %s\n", echo.RequestID)
+	}
+	fmt.Fprintf(w, "Hostname: %s\n", echo.Hostname)
+	if echo.Pod.Name != "" {
+		fmt.Fprintf(w, "Pod: %s/%s (%s) on %s\n", echo.Pod.Namespace, echo.Pod.Name, echo.Pod.IP, echo.Pod.NodeName)
+	}
+	if echo.TLS != nil {
+		fmt.Fprintf(w, "TLS: %s %s", echo.TLS.Version, echo.TLS.CipherSuite)
+		if echo.TLS.ServerName != "" {
+			fmt.Fprintf(w, " SNI=%s", echo.TLS.ServerName)
+		}
+		if echo.TLS.NegotiatedProtocol != "" {
+			fmt.Fprintf(w, " ALPN=%s", echo.TLS.NegotiatedProtocol)
+		}
+		fmt.Fprintln(w)
+		for _, subject := range echo.TLS.PeerCertificates {
+			fmt.Fprintf(w, "Client certificate: %s\n", subject)
+		}
+	}
+	writeEchoValues(w, "Headers", echo.Headers)
+	writeEchoValues(w, "Query", echo.Query)
+	if echo.BodySize < 0 {
+		fmt.Fprint(w, "\nBody (unknown size")
+	} else {
+		fmt.Fprintf(w, "\nBody (%d bytes", echo.BodySize)
+	}
+	if echo.BodyTruncated {
+		fmt.Fprintf(w, ", truncated to %d", maxEchoBody)
+	}
+	if echo.BodyEncoding != "" {
+		fmt.Fprintf(w, ", %s", echo.BodyEncoding)
+	}
+	fmt.Fprintf(w, "):\n%s\n", echo.Body)
+}
+
+func writeEchoValues(w io.Writer, title string, values map[string][]string) {
+	if len(values) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n%s:\n", title)
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "  %s: %s\n", k, strings.Join(values[k], ", "))
+	}
+}
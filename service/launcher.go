@@ -2,21 +2,26 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"math/rand"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/kabacloud/cloudnativehomework4-module10/environment"
 	"github.com/kabacloud/cloudnativehomework4-module10/logger"
 	"github.com/kabacloud/cloudnativehomework4-module10/metrics"
 	"github.com/kabacloud/cloudnativehomework4-module10/middleware"
+	"github.com/kabacloud/cloudnativehomework4-module10/tracing"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/viper"
 )
 
 var (
 	isReady bool // 服务是否准备就绪
 	log     *logger.LoggerProvider
+	// 设定了SLO时在进程内计算错误预算和燃烧率
+	sloTracker *metrics.SLOTracker
 )
 
 func init() {
@@ -26,7 +31,18 @@ func init() {
 func Start(ctxMain context.Context) error {
 	var srv *http.Server
 
-	log = logger.NewLogger("debug", "httpserver")
+	// 读取配置
+	cfg, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	log, err = logger.NewLoggerWithOptions(cfg.Log)
+	if err != nil {
+		return err
+	}
+	// 标准库log和log/slog的输出也写入日志部品
+	log.SetDefault()
 
 	// 根据环境区分的操作
 	if environment.IsProduction() {
@@ -34,22 +50,130 @@ func Start(ctxMain context.Context) error {
 	} else {
 		log.Info("服务执行在非生产环境下")
 	}
+	// HWENV不是已知的执行环境时使用了fallback的配置
+	if environment.ExecENV != "" && !strings.EqualFold(environment.ExecENV, environment.ExecProfile.Name) {
+		log.WarnI("未知的执行环境"+environment.ExecENV+"，使用fallback的配置", "profile", environment.ExecProfile.Name)
+	} else if environment.ExecProfile.Name != "" {
+		log.InfoI("执行环境的配置", "profile", environment.ExecProfile.Name)
+	}
+
+	// 按容器的内存上限设定Go运行时的软内存上限，减少接近上限时被OOMKill的可能
+	limit, err := environment.ApplyMemoryLimit(cfg.Runtime)
+	if err != nil {
+		log.Error("运行时配置错误", err)
+		return err
+	}
+	if limit > 0 {
+		log.InfoI("已按容器的内存上限设定GOMEMLIMIT", "bytes", limit)
+	}
 
-	// 加载prometheus注册器
-	r := metrics.LoadRegistry()
+	// 从文件读取认证用的密码和令牌
+	if cfg.Metrics.Auth, err = cfg.Metrics.Auth.Load(); err != nil {
+		log.Error("/metrics 的认证配置错误", err)
+		return err
+	}
+	if cfg.Chaos.Admin, err = cfg.Chaos.Admin.Load(); err != nil {
+		log.Error("/admin/chaos 的认证配置错误", err)
+		return err
+	}
+
+	// 访问日志的排除和采样
+	if err := middleware.InitAccessLog(cfg.AccessLog); err != nil {
+		log.Error("访问日志配置错误", err)
+		return err
+	}
+	// 请求头带入应答的方式
+	if err := middleware.InitRequestHeader(cfg.RequestHeader); err != nil {
+		log.Error("请求头配置错误", err)
+		return err
+	}
+	// 采用 X-Forwarded-For 的可信的代理
+	if err := middleware.InitClientIP(cfg.ClientIP); err != nil {
+		log.Error("可信的代理配置错误", err)
+		return err
+	}
+
+	// 加载prometheus注册器，设定了SLO时在进程内计算错误预算和燃烧率
+	r, tracker, err := LoadRegistry(cfg)
+	if err != nil {
+		log.Error("指标配置错误", err)
+		return err
+	}
+	sloTracker = tracker
+	// 中间件和处理函数记录指标用，同时输出到以下设定的各后端，通过 InitMetrics、InitChaos 等注入，测试时注入 metrics.MemoryRecorder
+	prometheusRecorder := metrics.NewPrometheusRecorder(r)
+	prometheusRecorder.OnError = func(name string, err error) {
+		log.ErrorI("指标记录失败", err, "metric", name)
+	}
+	recorder := metrics.Recorders{prometheusRecorder}
+	if tracker != nil {
+		recorder = append(recorder, tracker)
+	}
+	// 设定了Pushgateway时定期以及在退出时推送指标
+	var pusher *metrics.Pusher
+	if cfg.Metrics.Push.URL != "" {
+		if pusher, err = metrics.NewPusher(r, cfg.Metrics.Push); err != nil {
+			log.Error("Pushgateway推送配置错误", err)
+			return err
+		}
+	}
+	// 设定了OTLP协议时同时导出到OpenTelemetry Collector，/metrics 仍然有效
+	var otlp *metrics.OTLPExporter
+	if cfg.Metrics.OTLP.Protocol != "" {
+		if otlp, err = metrics.StartOTLP(ctxMain, cfg.Metrics.OTLP); err != nil {
+			log.Error("OTLP指标导出配置错误", err)
+			return err
+		}
+		recorder = append(recorder, otlp)
+	}
+	// 设定了StatsD代理时同时输出请求的计数和计时
+	var statsd *metrics.StatsD
+	if cfg.Metrics.StatsD.Address != "" {
+		if statsd, err = metrics.NewStatsD(cfg.Metrics.StatsD); err != nil {
+			log.Error("StatsD指标输出配置错误", err)
+			return err
+		}
+		recorder = append(recorder, statsd)
+	}
+	// 设定了OTLP协议时导出链路追踪，未设定时仍然传播上游的trace
+	var tracer *tracing.Provider
+	if cfg.Tracing.Protocol != "" {
+		if tracer, err = tracing.Start(ctxMain, cfg.Tracing); err != nil {
+			log.Error("链路追踪导出配置错误", err)
+			return err
+		}
+	}
+	middleware.InitMetrics(recorder)
+	// 按路由注入故障，注入的延时记录为 httpserver_sleep_duration_seconds
+	if err := middleware.InitChaos(cfg.Chaos, recorder); err != nil {
+		log.Error("故障注入配置错误", err)
+		return err
+	}
+	metrics.RegisterLogSuppressed("logger", log.Suppressed)
+	metrics.RegisterLogSuppressed("access", middleware.AccessLogSuppressed)
 
 	// 定义路由
 	// k8s关于健康检查API的说明 https://kubernetes.io/zh/docs/reference/using-api/health-checks/
-	http.Handle("/healthz", middleware.ResponseLog(http.HandlerFunc(healthHandler))) // 健康检查
-	http.Handle("/livez", middleware.ResponseLog(http.HandlerFunc(healthHandler)))   // 健康检查
-	http.Handle("/readyz", middleware.ResponseLog(http.HandlerFunc(readyHandler)))   // 就绪检查
+	handle("/healthz", middleware.ResponseLog("/healthz", http.HandlerFunc(healthHandler))) // 健康检查
+	handle("/livez", middleware.ResponseLog("/livez", http.HandlerFunc(healthHandler)))     // 健康检查
+	handle("/readyz", middleware.ResponseLog("/readyz", http.HandlerFunc(readyHandler)))    // 就绪检查
 	// k8s指标监控
-	http.Handle("/metrics", promhttp.HandlerFor(r, promhttp.HandlerOpts{Registry: r}))
+	// 客户端支持时以OpenMetrics格式输出，以便输出exemplar；设定了认证时需Basic认证或Bearer令牌
+	http.Handle("/metrics", middleware.Auth(cfg.Metrics.Auth, promhttp.HandlerFor(r, promhttp.HandlerOpts{Registry: r, EnableOpenMetrics: true})))
+	http.Handle("/slo", middleware.ResponseLog("/slo", http.HandlerFunc(sloHandler))) // SLO的错误预算和燃烧率
+	// 运行时切换故障注入，可以让所有路由返回错误，所以只在设定了认证时注册
+	if cfg.Chaos.Admin.Enabled() {
+		http.Handle("/admin/chaos", middleware.Auth(cfg.Chaos.Admin, middleware.ResponseLog("/admin/chaos", http.HandlerFunc(chaosHandler))))
+	} else {
+		log.Warn("没有设定 chaos.admin 的认证，不提供 /admin/chaos")
+	}
 	// 服务功能API
-	http.Handle("/info", middleware.RequestHeader(middleware.ResponseLog(http.HandlerFunc(infoHandler)))) // 基本功能
-	http.Handle("/", middleware.RequestHeader(middleware.ResponseLog(http.HandlerFunc(infoHandler))))     // 基本功能
-	// http.Handle("/giteataskrun", middleware.RequestHeader(middleware.ResponseLog(http.HandlerFunc(giteatask.GiteaWebhookHandler)))) // gitea webhook 触发 tekton 的 PipelineRun
-	http.Handle("/run", middleware.RequestHeader(middleware.ResponseLog(http.HandlerFunc(runHandler)))) // 服务
+	handle("/info", middleware.RequestHeader(middleware.ResponseLog("/info", http.HandlerFunc(infoHandler)))) // 基本功能
+	handle("/", middleware.RequestHeader(middleware.ResponseLog("/", http.HandlerFunc(infoHandler))))         // 基本功能
+	// handle("/giteataskrun", middleware.RequestHeader(middleware.ResponseLog("/giteataskrun", http.HandlerFunc(giteatask.GiteaWebhookHandler)))) // gitea webhook 触发 tekton 的 PipelineRun
+	handle("/run", middleware.RequestHeader(middleware.ResponseLog("/run", http.HandlerFunc(runHandler)))) // 服务
+	handle("/echo", middleware.ResponseLog("/echo", http.HandlerFunc(echoHandler)))                        // 回显收到的请求，调试Ingress和服务网格用
+	handle("/version", middleware.ResponseLog("/version", http.HandlerFunc(versionHandler)))               // 构建信息
 
 	// 定义服务器
 	srv = &http.Server{
@@ -64,6 +188,7 @@ func Start(ctxMain context.Context) error {
 		log.Info("服务开始监听退出信号")
 		<-ctxMain.Done()
 		log.Info("服务监听到了退出信号")
+		metrics.SetLifecycleState(metrics.LifecycleStopping)
 		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 		defer cancel()
 		log.Info("服务停止接收新的请求")
@@ -73,12 +198,38 @@ func Start(ctxMain context.Context) error {
 		log.Info("服务已处理完现有请求")
 		cleanup()
 		log.Info("服务已完全关闭")
+		metrics.SetLifecycleState(metrics.LifecycleStopped)
+		if pusher != nil {
+			if err := pusher.Stop(context.Background()); err != nil {
+				log.Error("推送指标失败", err)
+			}
+		}
+		if otlp != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := otlp.Shutdown(ctx); err != nil {
+				log.Error("OTLP导出指标失败", err)
+			}
+			cancel()
+		}
+		if tracer != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := tracer.Shutdown(ctx); err != nil {
+				log.Error("导出链路追踪失败", err)
+			}
+			cancel()
+		}
+		if statsd != nil {
+			if err := statsd.Close(); err != nil {
+				log.Error("StatsD发送指标失败", err)
+			}
+		}
+		_ = log.Close()
 		close(processed)
 	}()
 
 	// 开始服务前的准备工作，比如读取配置、准备数据库连接等等工作
 	go ready()
-	err := srv.ListenAndServe()
+	err = srv.ListenAndServe()
 	if http.ErrServerClosed != err {
 		log.FatalI("server not gracefully shutdown", "error", err)
 	}
@@ -89,10 +240,20 @@ func Start(ctxMain context.Context) error {
 	return nil
 }
 
+// 注册路由，所有路由都带有请求ID和服务端span并记录请求指标，注入的故障也计入指标
+func handle(pattern string, handler http.Handler) {
+	http.Handle(pattern, middleware.RequestID(middleware.Tracing(pattern, middleware.Metrics(pattern, middleware.Chaos(pattern, handler)))))
+}
+
 // 开始前的准备工作
 func ready() {
 	log.Info("服务的准备工作开始进行")
 	time.Sleep(10 * time.Second)
+	// 准备期间收到了退出信号时不再就绪
+	if !metrics.CompareAndSetLifecycleState(metrics.LifecycleStarting, metrics.LifecycleReady) {
+		log.Info("服务已开始停止，不再就绪")
+		return
+	}
 	isReady = true
 	log.Info("服务的准备工作已完成")
 }
@@ -105,29 +266,90 @@ func cleanup() {
 	log.Info("服务的收尾工作已完成")
 }
 
-// 打印服务基本信息
+// 打印服务基本信息，随机延时由故障注入的设定添加（默认0-2秒的均匀分布）。
+// 默认输出文本，按 ?format=json|yaml|text 或Accept请求头输出JSON或YAML
 func infoHandler(w http.ResponseWriter, r *http.Request) {
-	// 添加 0-2 秒的随机延时
-	rand.Seed(time.Now().UnixNano())
-	min := 0.0
-	max := 2.0
-	duration := min + rand.Float64()*(max-min)
-	time.Sleep(time.Second * time.Duration(duration))
-
-	metrics.RecordSleep(duration)
-	// 返回处理结果
-	fmt.Fprint(w, environment.AppInfo())
+	varyAccept(w)
+	format, err := responseFormat(r, mediaText, mediaJSON, mediaYAML)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	info := environment.Info()
+	if format == mediaText {
+		fmt.Fprint(w, info)
+		return
+	}
+	writeEncoded(w, format, info)
+}
+
+// 打印构建信息，格式和 /info 相同
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	varyAccept(w)
+	format, err := responseFormat(r, mediaText, mediaJSON, mediaYAML)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if format == mediaText {
+		fmt.Fprint(w, environment.Build)
+		return
+	}
+	writeEncoded(w, format, environment.Build)
+}
+
+// 故障注入的设定：GET取得当前设定，PUT以和配置文件chaos节点相同结构的JSON替换，DELETE停止注入
+func chaosHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		v := viper.New()
+		v.SetConfigType("json")
+		if err := v.ReadConfig(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var opts middleware.ChaosOptions
+		if err := v.Unmarshal(&opts); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := middleware.SetChaos(opts); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+		opts := middleware.ChaosState()
+		opts.Enabled = false
+		_ = middleware.SetChaos(opts)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(middleware.ChaosState())
+}
+
+// SLO的错误预算和燃烧率
+func sloHandler(w http.ResponseWriter, r *http.Request) {
+	if sloTracker == nil {
+		http.Error(w, "SLO未设定", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(sloTracker.Report())
 }
 
 // 健康检查用（k8s存活探针）
 func healthHandler(w http.ResponseWriter, r *http.Request) {
-	log.Debug("healthHandler called")
+	logger.LoggerFromContext(r.Context()).Debug("healthHandler called")
 	w.WriteHeader(http.StatusOK)
 }
 
 // 就绪检查用（k8s就绪探针）
 func readyHandler(w http.ResponseWriter, r *http.Request) {
-	log.Debug("readyHandler called")
+	logger.LoggerFromContext(r.Context()).Debug("readyHandler called")
 	if isReady {
 		w.WriteHeader(http.StatusOK)
 	} else {
@@ -137,7 +359,7 @@ func readyHandler(w http.ResponseWriter, r *http.Request) {
 
 // 服务
 func runHandler(w http.ResponseWriter, r *http.Request) {
-	log.Debug("runHandler called")
+	logger.LoggerFromContext(r.Context()).Debug("runHandler called")
 	// 每次请求的statuscode只能写一次，向w的body写入时会默认尝试写入200。
 	// 如果想自定义statuscode必须要在写入body前执行，否则就无效会报错“http: superfluous response.WriteHeader call from 你的代码”
 	// 正确的设定顺序是 应答头（1） < 状态码（2） < 应答体（3）
@@ -2,15 +2,26 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/cookiejar"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/fortytw2/leaktest"
+	"github.com/kabacloud/cloudnativehomework4-module10/environment"
+	"github.com/kabacloud/cloudnativehomework4-module10/metrics"
+	"github.com/kabacloud/cloudnativehomework4-module10/middleware"
+	"github.com/kabacloud/cloudnativehomework4-module10/tracing"
+	"github.com/spf13/viper"
 	"github.com/steinfletcher/apitest"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/yaml.v3"
 )
 
 // 测试步骤中加入 `Report(apitest.SequenceDiagram())` 后可以在测试时生成时序图
@@ -44,11 +55,357 @@ func TestUnit_readyHandler(t *testing.T) {
 
 func TestUnit_infoHandler(t *testing.T) {
 	defer leaktest.Check(t)()
+
+	assert := assert.New(t)
+
+	// 默认的故障注入设定为 /info 添加0-2秒的随机延时
+	m := metrics.NewMemoryRecorder()
+	assert.NoError(middleware.InitChaos(defaultChaos(), m))
+	defer middleware.InitChaos(middleware.ChaosOptions{}, nil)
+
+	apitest.New().Handler(middleware.Chaos("/info", http.HandlerFunc(infoHandler))).
+		Get("/info").
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+
+	sleeps := m.Observations(metrics.SleepDurationName, nil)
+	if assert.Len(sleeps, 1) {
+		assert.True(sleeps[0] >= 0 && sleeps[0] <= 2)
+	}
+}
+
+func TestUnit_infoHandlerFormats(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	assert := assert.New(t)
+
+	// 默认输出文本
+	apitest.New().HandlerFunc(infoHandler).
+		Get("/info").
+		Header("Accept", "*/*").
+		Expect(t).
+		Status(http.StatusOK).
+		Assert(func(res *http.Response, req *http.Request) error {
+			b, _ := io.ReadAll(res.Body)
+			assert.Contains(string(b), "Hostname:\t")
+			return nil
+		}).
+		End()
+
+	apitest.New().HandlerFunc(infoHandler).
+		Get("/info").
+		Header("Accept", "application/json").
+		Expect(t).
+		Status(http.StatusOK).
+		Header("Content-Type", "application/json").
+		Header("Vary", "Accept").
+		Assert(func(res *http.Response, req *http.Request) error {
+			var info environment.AppInfo
+			assert.NoError(json.NewDecoder(res.Body).Decode(&info))
+			assert.Equal(environment.Hostname, info.Hostname)
+			assert.True(info.UptimeSeconds > 0)
+			return nil
+		}).
+		End()
+
+	// format参数优先于Accept
 	apitest.New().HandlerFunc(infoHandler).
 		Get("/info").
+		Query("format", "yaml").
+		Header("Accept", "application/json").
+		Expect(t).
+		Status(http.StatusOK).
+		Header("Content-Type", "application/yaml").
+		Assert(func(res *http.Response, req *http.Request) error {
+			var info environment.AppInfo
+			assert.NoError(yaml.NewDecoder(res.Body).Decode(&info))
+			assert.Equal(environment.Hostname, info.Hostname)
+			return nil
+		}).
+		End()
+
+	apitest.New().HandlerFunc(infoHandler).
+		Get("/info").
+		Query("format", "xml").
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func TestUnit_versionHandler(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	apitest.New().HandlerFunc(versionHandler).
+		Get("/version").
+		Query("format", "json").
+		Expect(t).
+		Status(http.StatusOK).
+		Header("Content-Type", "application/json").
+		Header("Vary", "Accept").
+		Assert(func(res *http.Response, req *http.Request) error {
+			var build environment.BuildMeta
+			assert.NoError(t, json.NewDecoder(res.Body).Decode(&build))
+			assert.Equal(t, environment.Build, build)
+			assert.NotEmpty(t, build.GoVersion)
+			return nil
+		}).
+		End()
+}
+
+func TestUnit_infoHandlerTracing(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	assert := assert.New(t)
+
+	exporter := tracetest.NewInMemoryExporter()
+	p, err := tracing.StartWithExporter(exporter, tracing.Options{})
+	assert.NoError(err)
+	defer p.Shutdown(context.Background())
+	assert.NoError(middleware.InitChaos(middleware.ChaosOptions{Enabled: true, Routes: map[string]middleware.ChaosRule{
+		"/info": {Latency: middleware.ChaosLatency{Distribution: middleware.LatencyFixed, Fixed: time.Millisecond}},
+	}}, nil))
+	defer middleware.InitChaos(middleware.ChaosOptions{}, nil)
+
+	apitest.New().Handler(middleware.Tracing("/info", middleware.Chaos("/info", http.HandlerFunc(infoHandler)))).
+		Get("/info").
+		Header("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01").
+		Expect(t).
+		Status(http.StatusOK).
+		Assert(func(res *http.Response, req *http.Request) error {
+			assert.Contains(res.Header.Get("traceparent"), "4bf92f3577b34da6a3ce929d0e0e4736")
+			return nil
+		}).
+		End()
+	assert.NoError(p.ForceFlush(context.Background()))
+
+	// 延时记录为服务端span的子span
+	spans := exporter.GetSpans()
+	if assert.Len(spans, 2) {
+		sleep, server := spans[0], spans[1]
+		assert.Equal("sleep", sleep.Name)
+		assert.Equal("GET /info", server.Name)
+		assert.Equal(trace.SpanKindServer, server.SpanKind)
+		assert.Equal(server.SpanContext.SpanID(), sleep.Parent.SpanID())
+		assert.Equal("00f067aa0ba902b7", server.Parent.SpanID().String())
+		assert.Equal("4bf92f3577b34da6a3ce929d0e0e4736", sleep.SpanContext.TraceID().String())
+	}
+}
+
+func TestUnit_sloHandler(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	apitest.New().HandlerFunc(sloHandler).
+		Get("/slo").
+		Expect(t).
+		Status(http.StatusNotFound).
+		End()
+
+	tracker, err := metrics.NewSLOTracker(metrics.SLOOptions{Objectives: []metrics.SLOObjective{
+		{Name: "availability", Type: metrics.SLOAvailability, Target: 0.999},
+	}})
+	assert.NoError(t, err)
+	sloTracker = tracker
+	defer func() { sloTracker = nil }()
+
+	apitest.New().HandlerFunc(sloHandler).
+		Get("/slo").
+		Expect(t).
+		Status(http.StatusOK).
+		Header("Content-Type", "application/json").
+		Assert(func(res *http.Response, req *http.Request) error {
+			var report metrics.SLOReport
+			assert.NoError(t, json.NewDecoder(res.Body).Decode(&report))
+			if assert.Len(t, report.Objectives, 1) {
+				assert.Equal(t, "availability", report.Objectives[0].Name)
+				assert.Equal(t, 1.0, report.Objectives[0].SLI)
+			}
+			return nil
+		}).
+		End()
+}
+
+func TestUnit_chaosHandler(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	assert := assert.New(t)
+	defer middleware.InitChaos(middleware.ChaosOptions{}, nil)
+
+	apitest.New().HandlerFunc(chaosHandler).
+		Put("/admin/chaos").
+		JSON(`{"enabled": true, "routes": {"/run": {"latency": {"distribution": "fixed", "fixed": "20ms"}, "errorpercent": 50}}}`).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+	state := middleware.ChaosState()
+	assert.True(state.Enabled)
+	assert.Equal(20*time.Millisecond, state.Routes["/run"].Latency.Fixed)
+	assert.Equal(50.0, state.Routes["/run"].ErrorPercent)
+
+	// 取得的设定可以直接PUT
+	apitest.New().HandlerFunc(chaosHandler).
+		Get("/admin/chaos").
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"enabled":true,"headers":false,"routes":{"/run":{"latency":{"distribution":"fixed","fixed":"20ms"},"errorpercent":50,"errorstatus":0,"abortpercent":0,"bandwidth":0}}}`).
+		End()
+
+	apitest.New().HandlerFunc(chaosHandler).
+		Put("/admin/chaos").
+		JSON(`{"enabled": true, "routes": {"/run": {"errorpercent": 200}}}`).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+
+	apitest.New().HandlerFunc(chaosHandler).
+		Delete("/admin/chaos").
 		Expect(t).
 		Status(http.StatusOK).
 		End()
+	assert.False(middleware.ChaosState().Enabled)
+}
+
+func TestUnit_loadConfigProfile(t *testing.T) {
+	assert := assert.New(t)
+
+	savedProfile := environment.ExecProfile
+	defer func() {
+		viper.Reset()
+		environment.ExecProfile = savedProfile
+	}()
+
+	viper.SetConfigType("yaml")
+	assert.NoError(viper.ReadConfig(strings.NewReader(`
+environment:
+  profiles:
+    staging:
+      loglevel: info
+      chaos: false
+      headerecho: redact
+log:
+  level: debug
+requestheader:
+  echo: all
+`)))
+
+	// 执行环境的配置覆盖各节点的设定，没有chaos节点时的默认延时也被停止
+	t.Setenv("HWENV", "Staging")
+	cfg, err := LoadConfig()
+	assert.NoError(err)
+	assert.Equal("staging", environment.ExecProfile.Name)
+	assert.Equal("info", cfg.Log.Level)
+	assert.False(cfg.Chaos.Enabled)
+	assert.Equal(middleware.HeaderEchoRedact, cfg.RequestHeader.Echo)
+
+	// 内置的配置不覆盖
+	t.Setenv("HWENV", "Develop")
+	cfg, err = LoadConfig()
+	assert.NoError(err)
+	assert.Equal("debug", cfg.Log.Level)
+	assert.True(cfg.Chaos.Enabled)
+	assert.Equal(middleware.HeaderEchoAll, cfg.RequestHeader.Echo)
+
+	// 未知的执行环境没有fallback时启动失败
+	t.Setenv("HWENV", "qa")
+	_, err = LoadConfig()
+	assert.ErrorContains(err, `unknown HWENV "qa"`)
+
+	viper.Set("environment.fallback", "staging")
+	cfg, err = LoadConfig()
+	assert.NoError(err)
+	assert.Equal("staging", environment.ExecProfile.Name)
+	assert.Equal("info", cfg.Log.Level)
+}
+
+func TestUnit_loadConfigEnv(t *testing.T) {
+	assert := assert.New(t)
+	defer viper.Reset()
+
+	// 配置文件中没有的认证信息也可以通过环境变量设定
+	t.Setenv("METRICS_AUTH_BEARERTOKEN", "metrics-token")
+	t.Setenv("CHAOS_ADMIN_USERNAME", "admin")
+	t.Setenv("CHAOS_ADMIN_PASSWORD", "admin-pass")
+	BindEnv()
+	viper.SetConfigType("yaml")
+	assert.NoError(viper.ReadConfig(strings.NewReader("log:\n  level: info\n")))
+
+	cfg, err := LoadConfig()
+	assert.NoError(err)
+	assert.Equal("metrics-token", cfg.Metrics.Auth.BearerToken)
+	assert.Equal("admin", cfg.Chaos.Admin.Username)
+	assert.Equal("admin-pass", cfg.Chaos.Admin.Password)
+	// 没有chaos节点时仍使用默认的延时
+	assert.True(cfg.Chaos.Enabled)
+	assert.Contains(cfg.Chaos.Routes, "/info")
+}
+
+func TestUnit_echoHandler(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	assert := assert.New(t)
+	assert.NoError(middleware.InitClientIP(middleware.ClientIPOptions{TrustedProxies: []string{"10.0.0.0/8"}}))
+	defer func() { _ = middleware.InitClientIP(middleware.ClientIPOptions{}) }()
+
+	apitest.New().HandlerFunc(echoHandler).
+		Intercept(func(r *http.Request) { r.RemoteAddr = "10.0.0.2:51234" }).
+		Post("/echo").
+		Query("q", "1").
+		Query("api_key", "secret").
+		Header("X-Forwarded-For", "198.51.100.1, 203.0.113.7, 10.0.0.1").
+		Header("Authorization", "Bearer secret").
+		Body(`{"hello":"world"}`).
+		Expect(t).
+		Status(http.StatusOK).
+		Header("Content-Type", "application/json").
+		Header("Vary", "Accept").
+		Assert(func(res *http.Response, req *http.Request) error {
+			var echo echoResponse
+			assert.NoError(json.NewDecoder(res.Body).Decode(&echo))
+			assert.Equal(http.MethodPost, echo.Method)
+			assert.Equal([]string{"1"}, echo.Query["q"])
+			// 查询参数也按日志的脱敏规则替换
+			assert.NotContains(echo.Query["api_key"][0], "secret")
+			assert.NotContains(echo.URL, "secret")
+			assert.Equal(`{"hello":"world"}`, echo.Body)
+			assert.Equal(int64(17), echo.BodySize)
+			assert.False(echo.BodyTruncated)
+			assert.Equal("203.0.113.7", echo.ClientIP)
+			assert.NotContains(echo.Headers["Authorization"][0], "secret")
+			return nil
+		}).
+		End()
+
+	// 超过上限的请求体只读取前 maxEchoBody 字节，大小取Content-Length
+	apitest.New().HandlerFunc(echoHandler).
+		Put("/echo").
+		Header("Accept", "application/yaml").
+		Body(strings.Repeat("x", maxEchoBody+10)).
+		Expect(t).
+		Status(http.StatusOK).
+		Header("Content-Type", "application/yaml").
+		Assert(func(res *http.Response, req *http.Request) error {
+			var echo echoResponse
+			assert.NoError(yaml.NewDecoder(res.Body).Decode(&echo))
+			assert.Len(echo.Body, maxEchoBody)
+			assert.Equal(int64(maxEchoBody+10), echo.BodySize)
+			assert.True(echo.BodyTruncated)
+			return nil
+		}).
+		End()
+
+	apitest.New().HandlerFunc(echoHandler).
+		Get("/echo").
+		Header("Accept", "text/plain").
+		Header("X-Test", "a").
+		Expect(t).
+		Status(http.StatusOK).
+		Assert(func(res *http.Response, req *http.Request) error {
+			b, _ := io.ReadAll(res.Body)
+			assert.Contains(string(b), "GET /echo HTTP/1.1\n")
+			assert.Contains(string(b), "  X-Test: a\n")
+			return nil
+		}).
+		End()
 }
 
 func TestUnit_runHandler(t *testing.T) {
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 应答的格式
+const (
+	mediaJSON = "application/json"
+	mediaYAML = "application/yaml"
+	mediaText = "text/plain"
+)
+
+// YAML的其他媒体类型
+var yamlAliases = map[string]bool{"application/x-yaml": true, "text/yaml": true, "text/x-yaml": true}
+
+// negotiate 按Accept请求头的顺序和q值从offers中选择应答的格式，没有Accept或都不匹配时返回offers的第一个
+func negotiate(accept string, offers ...string) string {
+	type mediaRange struct {
+		typ string
+		q   float64
+	}
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		typ, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if yamlAliases[typ] {
+			typ = mediaYAML
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, mediaRange{typ: typ, q: q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+
+	for _, r := range ranges {
+		for _, offer := range offers {
+			if r.typ == offer || r.typ == "*/*" || (strings.HasSuffix(r.typ, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(r.typ, "*"))) {
+				return offer
+			}
+		}
+	}
+	return offers[0]
+}
+
+// responseFormat 应答的格式：?format=json|yaml|text 优先于Accept请求头，没有指定时为offers的第一个
+func responseFormat(r *http.Request, offers ...string) (string, error) {
+	switch r.URL.Query().Get("format") {
+	case "":
+		return negotiate(r.Header.Get("Accept"), offers...), nil
+	case "json":
+		return mediaJSON, nil
+	case "yaml", "yml":
+		return mediaYAML, nil
+	case "text", "txt":
+		return mediaText, nil
+	default:
+		return "", fmt.Errorf("format只支持json、yaml和text")
+	}
+}
+
+// varyAccept 应答的格式由Accept请求头决定，告知缓存按Accept区分
+func varyAccept(w http.ResponseWriter) {
+	w.Header().Add("Vary", "Accept")
+}
+
+// writeEncoded 以JSON或YAML输出应答，文本格式由调用方输出
+func writeEncoded(w http.ResponseWriter, format string, v interface{}) {
+	w.Header().Set("Content-Type", format)
+	if format == mediaYAML {
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		_ = enc.Encode(v)
+		return
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
@@ -0,0 +1,23 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnit_negotiate(t *testing.T) {
+	assert := assert.New(t)
+
+	offers := []string{mediaJSON, mediaYAML, mediaText}
+	assert.Equal(mediaJSON, negotiate("", offers...))
+	assert.Equal(mediaJSON, negotiate("*/*", offers...))
+	assert.Equal(mediaYAML, negotiate("application/yaml", offers...))
+	assert.Equal(mediaYAML, negotiate("application/x-yaml", offers...))
+	assert.Equal(mediaText, negotiate("text/*", offers...))
+	assert.Equal(mediaText, negotiate("text/html, text/plain;q=0.9, application/json;q=0.5", offers...))
+	assert.Equal(mediaYAML, negotiate("text/plain;q=0.2, application/yaml", offers...))
+	// 不匹配或q=0时使用第一个
+	assert.Equal(mediaJSON, negotiate("image/png", offers...))
+	assert.Equal(mediaJSON, negotiate("text/plain;q=0", offers...))
+}
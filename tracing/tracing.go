@@ -0,0 +1,155 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kabacloud/cloudnativehomework4-module10/environment"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OTLP的传输协议
+const (
+	ProtocolHTTP = "http" // OTLP/HTTP，默认端口4318
+	ProtocolGRPC = "grpc" // OTLP/gRPC，默认端口4317
+)
+
+const (
+	defaultServiceName = "httpserver"
+	scope              = "github.com/kabacloud/cloudnativehomework4-module10"
+)
+
+// Options 通过OTLP导出链路追踪的配置
+type Options struct {
+	Protocol    string            `mapstructure:"protocol"`    // 传输协议：http/grpc，为空时不导出，但仍然传播请求头中的trace
+	Endpoint    string            `mapstructure:"endpoint"`    // OpenTelemetry Collector的地址，如 otel-collector:4318，为空时使用SDK的默认值
+	Insecure    bool              `mapstructure:"insecure"`    // 不使用TLS
+	Headers     map[string]string `mapstructure:"headers"`     // 追加的请求头，如认证信息
+	Timeout     time.Duration     `mapstructure:"timeout"`     // 单次导出的超时时间，默认10秒
+	SampleRatio *float64          `mapstructure:"sampleratio"` // 没有上游trace时的采样比例（0~1），默认全部采样；有上游trace时沿用上游的采样决定
+	ServiceName string            `mapstructure:"service"`     // 资源属性service.name，默认为 httpserver
+	Attributes  map[string]string `mapstructure:"attributes"`  // 追加的资源属性
+}
+
+// Provider 导出链路追踪的TracerProvider
+type Provider struct {
+	provider *sdktrace.TracerProvider
+}
+
+func init() {
+	// 不导出时也按W3C traceparent/baggage传播，上游的trace ID可以用于日志和exemplar
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// Start 开始通过OTLP导出链路追踪，并设为全局的TracerProvider
+func Start(ctx context.Context, opts Options) (*Provider, error) {
+	exporter, err := newExporter(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	p, err := StartWithExporter(exporter, opts)
+	if err != nil {
+		_ = exporter.Shutdown(ctx)
+		return nil, err
+	}
+	return p, nil
+}
+
+// StartWithExporter 以指定的导出器开始链路追踪，并设为全局的TracerProvider。
+// 测试时可使用 tracetest.NewInMemoryExporter 同步导出
+func StartWithExporter(exporter sdktrace.SpanExporter, opts Options) (*Provider, error) {
+	ratio := 1.0
+	if opts.SampleRatio != nil {
+		ratio = *opts.SampleRatio
+	}
+	if ratio < 0 || ratio > 1 {
+		return nil, fmt.Errorf("tracing sample ratio %v must be between 0 and 1", ratio)
+	}
+
+	serviceName := opts.ServiceName
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, environment.ResourceAttributes(serviceName, opts.Attributes)...))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithBatcher(exporter),
+	)
+	otel.SetTracerProvider(provider)
+	return &Provider{provider: provider}, nil
+}
+
+// Shutdown 导出剩余的span后停止
+func (p *Provider) Shutdown(ctx context.Context) error {
+	return p.provider.Shutdown(ctx)
+}
+
+// ForceFlush 立即导出已结束的span
+func (p *Provider) ForceFlush(ctx context.Context) error {
+	return p.provider.ForceFlush(ctx)
+}
+
+// Tracer 服务使用的Tracer，每次从全局的TracerProvider取得，以便Start之后替换
+func Tracer() trace.Tracer {
+	return otel.Tracer(scope)
+}
+
+// TraceID 上下文中span的trace ID，没有时返回空串
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
+
+// newExporter 按传输协议生成导出器
+func newExporter(ctx context.Context, opts Options) (sdktrace.SpanExporter, error) {
+	switch opts.Protocol {
+	case ProtocolHTTP:
+		var httpOpts []otlptracehttp.Option
+		if opts.Endpoint != "" {
+			httpOpts = append(httpOpts, otlptracehttp.WithEndpoint(opts.Endpoint))
+		}
+		if opts.Insecure {
+			httpOpts = append(httpOpts, otlptracehttp.WithInsecure())
+		}
+		if len(opts.Headers) > 0 {
+			httpOpts = append(httpOpts, otlptracehttp.WithHeaders(opts.Headers))
+		}
+		if opts.Timeout > 0 {
+			httpOpts = append(httpOpts, otlptracehttp.WithTimeout(opts.Timeout))
+		}
+		return otlptracehttp.New(ctx, httpOpts...)
+	case ProtocolGRPC:
+		var grpcOpts []otlptracegrpc.Option
+		if opts.Endpoint != "" {
+			grpcOpts = append(grpcOpts, otlptracegrpc.WithEndpoint(opts.Endpoint))
+		}
+		if opts.Insecure {
+			grpcOpts = append(grpcOpts, otlptracegrpc.WithInsecure())
+		}
+		if len(opts.Headers) > 0 {
+			grpcOpts = append(grpcOpts, otlptracegrpc.WithHeaders(opts.Headers))
+		}
+		if opts.Timeout > 0 {
+			grpcOpts = append(grpcOpts, otlptracegrpc.WithTimeout(opts.Timeout))
+		}
+		return otlptracegrpc.New(ctx, grpcOpts...)
+	default:
+		return nil, fmt.Errorf("tracing protocol %q not supported", opts.Protocol)
+	}
+}
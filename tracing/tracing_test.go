@@ -0,0 +1,100 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+func TestUnit_startWithExporter(t *testing.T) {
+	assert := assert.New(t)
+
+	exporter := tracetest.NewInMemoryExporter()
+	p, err := StartWithExporter(exporter, Options{ServiceName: "test", Attributes: map[string]string{"team": "cloud"}})
+	assert.NoError(err)
+	defer p.Shutdown(context.Background())
+
+	// 从traceparent继续上游的trace
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	header.Set("baggage", "tenant=a")
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.HeaderCarrier(header))
+	assert.Equal("4bf92f3577b34da6a3ce929d0e0e4736", TraceID(ctx))
+
+	ctx, span := Tracer().Start(ctx, "parent")
+	_, child := Tracer().Start(ctx, "child")
+	child.End()
+	span.End()
+	assert.NoError(p.ForceFlush(context.Background()))
+
+	spans := exporter.GetSpans()
+	if assert.Len(spans, 2) {
+		assert.Equal("child", spans[0].Name)
+		assert.Equal(spans[1].SpanContext.SpanID(), spans[0].Parent.SpanID())
+		assert.Equal("00f067aa0ba902b7", spans[1].Parent.SpanID().String())
+		assert.Equal("4bf92f3577b34da6a3ce929d0e0e4736", spans[1].SpanContext.TraceID().String())
+		name, _ := spans[1].Resource.Set().Value(semconv.ServiceNameKey)
+		assert.Equal("test", name.AsString())
+		team, _ := spans[1].Resource.Set().Value("team")
+		assert.Equal("cloud", team.AsString())
+	}
+
+	// 注入时baggage一并传播
+	out := http.Header{}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(out))
+	assert.Contains(out.Get("traceparent"), "4bf92f3577b34da6a3ce929d0e0e4736")
+	assert.Equal("tenant=a", out.Get("baggage"))
+
+	assert.Equal("", TraceID(context.Background()))
+}
+
+func TestUnit_sampleRatio(t *testing.T) {
+	assert := assert.New(t)
+
+	invalid := 1.5
+	_, err := StartWithExporter(tracetest.NewInMemoryExporter(), Options{SampleRatio: &invalid})
+	assert.Error(err)
+
+	// 采样比例为0时没有上游trace的请求不导出
+	none := 0.0
+	exporter := tracetest.NewInMemoryExporter()
+	p, err := StartWithExporter(exporter, Options{SampleRatio: &none})
+	assert.NoError(err)
+	defer p.Shutdown(context.Background())
+
+	_, span := Tracer().Start(context.Background(), "unsampled")
+	span.End()
+	assert.NoError(p.ForceFlush(context.Background()))
+	assert.Empty(exporter.GetSpans())
+}
+
+func TestUnit_exportOnShutdown(t *testing.T) {
+	assert := assert.New(t)
+
+	var received atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/traces" {
+			received.Add(1)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	p, err := Start(context.Background(), Options{Protocol: ProtocolHTTP, Endpoint: srv.Listener.Addr().String(), Insecure: true})
+	assert.NoError(err)
+	_, span := Tracer().Start(context.Background(), "exported")
+	span.End()
+	assert.NoError(p.Shutdown(context.Background()))
+	assert.Equal(int32(1), received.Load())
+
+	_, err = Start(context.Background(), Options{Protocol: "zipkin"})
+	assert.Error(err)
+}